@@ -0,0 +1,227 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	v2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// AnnotationV2Spec stores the v2 spec of an EasyHttp read as v1, so the fields which cannot be represented in v1
+// are restored when the object is converted back to v2
+const AnnotationV2Spec = "httpapi.github.com/v2-spec"
+
+// AnnotationV2Status stores the v2 status of an EasyHttp read as v1, so the status fields which cannot be represented
+// in v1 are kept when the status is written as v1
+const AnnotationV2Status = "httpapi.github.com/v2-status"
+
+var _ conversion.Convertible = &EasyHttp{}
+
+// ConvertTo converts this EasyHttp to the Hub version (v2)
+func (src *EasyHttp) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v2.EasyHttp)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v2.EasyHttpSpec{}
+
+	// the fields of v2 which are missing from v1 are restored from the annotation written by ConvertFrom
+	var restored *v2.EasyHttpSpec
+	if data, ok := dst.Annotations[AnnotationV2Spec]; ok {
+		restored = &v2.EasyHttpSpec{}
+		if err := json.Unmarshal([]byte(data), restored); err != nil {
+			return fmt.Errorf("cannot restore v2 spec of %s from annotation %s. %v", src.Name, AnnotationV2Spec, err)
+		}
+		dst.Spec = *restored.DeepCopy()
+		delete(dst.Annotations, AnnotationV2Spec)
+	}
+	dst.Status = v2.EasyHttpStatus{}
+	if data, ok := dst.Annotations[AnnotationV2Status]; ok {
+		if err := json.Unmarshal([]byte(data), &dst.Status); err != nil {
+			return fmt.Errorf("cannot restore v2 status of %s from annotation %s. %v", src.Name, AnnotationV2Status, err)
+		}
+		delete(dst.Annotations, AnnotationV2Status)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	dst.Spec.Host = src.Spec.Host
+	dst.Spec.IngressClassName = src.Spec.IngressClassName
+	dst.Spec.Container.Image = src.Spec.Image
+	dst.Spec.Container.Tag = src.Spec.ImageTag
+	dst.Spec.Container.Port = int32(src.Spec.Port)
+	dst.Spec.TLS.Issuer = src.Spec.CertManInssuer
+	dst.Spec.Scaling.Replicas = copyReplicas(src.Spec.Replicas)
+
+	// the order of the env vars is kept when the env has not been changed in v1
+	if restored == nil {
+		dst.Spec.Container.Env = convertEnvTo(src.Spec.Env)
+	} else if !reflect.DeepEqual(convertEnvFrom(restored.Container.Env), src.Spec.Env) {
+		dst.Spec.Container.Env = append(convertEnvTo(src.Spec.Env), restoreEnvSources(restored.Container.Env, src.Spec.Env)...)
+	}
+	if restored == nil || convertRoutesFrom(restored.Routes) != src.Spec.Path {
+		dst.Spec.Routes = convertRoutesTo(src.Spec.Path)
+	}
+
+	dst.Status.Conditions = copyConditions(src.Status.Conditions)
+	dst.Status.DesiredReplicas = src.Status.DesiredReplicas
+	dst.Status.Replicas = src.Status.Replicas
+	dst.Status.UpdatedReplicas = src.Status.UpdatedReplicas
+	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
+	dst.Status.AvailableReplicas = src.Status.AvailableReplicas
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v2) to this version
+func (dst *EasyHttp) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v2.EasyHttp)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = EasyHttpSpec{
+		Host:             src.Spec.Host,
+		Replicas:         copyReplicas(src.Spec.Scaling.Replicas),
+		Image:            src.Spec.Container.Image,
+		ImageTag:         src.Spec.Container.Tag,
+		Port:             int(src.Spec.Container.Port),
+		Env:              convertEnvFrom(src.Spec.Container.Env),
+		CertManInssuer:   src.Spec.TLS.Issuer,
+		Path:             convertRoutesFrom(src.Spec.Routes),
+		IngressClassName: src.Spec.IngressClassName,
+	}
+
+	dst.Status = EasyHttpStatus{
+		Conditions:         copyConditions(src.Status.Conditions),
+		DesiredReplicas:    src.Status.DesiredReplicas,
+		Replicas:           src.Status.Replicas,
+		UpdatedReplicas:    src.Status.UpdatedReplicas,
+		ReadyReplicas:      src.Status.ReadyReplicas,
+		AvailableReplicas:  src.Status.AvailableReplicas,
+		ObservedGeneration: src.Status.ObservedGeneration,
+	}
+
+	// the v2 spec and status are stored only when they cannot be converted back from the v1 ones
+	back := &v2.EasyHttp{}
+	if err := dst.ConvertTo(back); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(back.Spec, src.Spec) {
+		if err := setAnnotation(dst, AnnotationV2Spec, src.Spec); err != nil {
+			return fmt.Errorf("cannot store v2 spec of %s in annotation %s. %v", src.Name, AnnotationV2Spec, err)
+		}
+	}
+	if !reflect.DeepEqual(back.Status, src.Status) {
+		if err := setAnnotation(dst, AnnotationV2Status, src.Status); err != nil {
+			return fmt.Errorf("cannot store v2 status of %s in annotation %s. %v", src.Name, AnnotationV2Status, err)
+		}
+	}
+	return nil
+}
+
+// setAnnotation stores value as JSON in the annotation of obj
+func setAnnotation(obj *EasyHttp, annotation string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if obj.Annotations == nil {
+		obj.Annotations = make(map[string]string)
+	}
+	obj.Annotations[annotation] = string(data)
+	return nil
+}
+
+// copyReplicas returns a copy of the replicas, so the converted objects do not share it
+func copyReplicas(replicas *int32) *int32 {
+	if replicas == nil {
+		return nil
+	}
+	ret := *replicas
+	return &ret
+}
+
+// copyConditions returns a copy of the conditions, so the converted objects do not share them
+func copyConditions(conditions []metav1.Condition) []metav1.Condition {
+	if conditions == nil {
+		return nil
+	}
+	ret := make([]metav1.Condition, len(conditions))
+	for i := range conditions {
+		conditions[i].DeepCopyInto(&ret[i])
+	}
+	return ret
+}
+
+// convertEnvTo converts the v1 env map into the v2 env list ordered by name
+func convertEnvTo(env map[string]string) []v2.EnvVar {
+	if len(env) == 0 {
+		return nil
+	}
+	ret := make([]v2.EnvVar, 0, len(env))
+	for name, value := range env {
+		ret = append(ret, v2.EnvVar{Name: name, Value: value})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// convertEnvFrom converts the v2 env list into the v1 env map, the env vars with value source are not represented in v1
+func convertEnvFrom(env []v2.EnvVar) map[string]string {
+	ret := make(map[string]string, len(env))
+	for _, e := range env {
+		if e.ValueFrom == nil {
+			ret[e.Name] = e.Value
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// restoreEnvSources returns the env vars with value source of the restored v2 env which are not overridden in the v1 env
+func restoreEnvSources(restored []v2.EnvVar, env map[string]string) []v2.EnvVar {
+	var ret []v2.EnvVar
+	for _, e := range restored {
+		if _, ok := env[e.Name]; !ok && e.ValueFrom != nil {
+			ret = append(ret, *e.DeepCopy())
+		}
+	}
+	return ret
+}
+
+// convertRoutesTo converts the v1 path into the v2 routes
+func convertRoutesTo(path string) []v2.RouteSpec {
+	if path == "" {
+		return nil
+	}
+	return []v2.RouteSpec{{Path: path}}
+}
+
+// convertRoutesFrom converts the v2 routes into the v1 path, v1 supports only one route
+func convertRoutesFrom(routes []v2.RouteSpec) string {
+	if len(routes) == 0 {
+		return ""
+	}
+	return routes[0].Path
+}
@@ -0,0 +1,173 @@
+package v1
+
+import (
+	"testing"
+
+	v2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertV1RoundTrip(t *testing.T) {
+	var replicas int32 = 3
+
+	tests := map[string]EasyHttpSpec{
+		"all fields": {
+			Host:             "example.net",
+			Replicas:         &replicas,
+			Image:            "gcr.io/kuar-demo/kuard-amd64",
+			ImageTag:         "1",
+			Port:             8080,
+			Env:              map[string]string{"PORT": "8080", "MODE": "prod"},
+			CertManInssuer:   "letsencrypt-staging",
+			Path:             "/app",
+			IngressClassName: "nginx",
+		},
+		"minimal": {
+			Host:  "example.net",
+			Image: "nginx",
+		},
+	}
+
+	for name, spec := range tests {
+		t.Run(name, func(t *testing.T) {
+			src := &EasyHttp{}
+			src.Name = "kuard-1"
+			src.Annotations = map[string]string{"foo": "bar"}
+			src.Spec = spec
+			src.Status.ObservedGeneration = 2
+			src.Status.Conditions = []metav1.Condition{{Type: v2.ConditionReady, Status: metav1.ConditionTrue}}
+
+			hub := &v2.EasyHttp{}
+			assert.NoError(t, src.ConvertTo(hub))
+			dst := &EasyHttp{}
+			assert.NoError(t, dst.ConvertFrom(hub))
+
+			// the v2 spec is not stored when v1 can represent it
+			assert.Equal(t, src, dst)
+		})
+	}
+}
+
+func TestConvertV2RoundTrip(t *testing.T) {
+	var replicas int32 = 2
+
+	src := &v2.EasyHttp{}
+	src.Name = "kuard-1"
+	src.Spec = v2.EasyHttpSpec{
+		Host: "example.net",
+		Container: v2.ContainerSpec{
+			Image: "nginx",
+			Tag:   "1.23",
+			Port:  80,
+			// not ordered by name
+			Env: []v2.EnvVar{{Name: "PORT", Value: "80"}, {Name: "MODE", Value: "prod"}},
+		},
+		Routes:  []v2.RouteSpec{{Path: "/"}},
+		TLS:     v2.TLSSpec{Issuer: "letsencrypt-prod"},
+		Scaling: v2.ScalingSpec{Replicas: &replicas},
+		Probes:  v2.ProbesSpec{HealthPath: "/healthz"},
+	}
+
+	spoke := &EasyHttp{}
+	assert.NoError(t, spoke.ConvertFrom(src))
+	assert.Contains(t, spoke.Annotations, AnnotationV2Spec)
+	assert.Equal(t, map[string]string{"PORT": "80", "MODE": "prod"}, spoke.Spec.Env)
+	assert.Equal(t, "/", spoke.Spec.Path)
+	assert.Equal(t, "letsencrypt-prod", spoke.Spec.CertManInssuer)
+
+	dst := &v2.EasyHttp{}
+	assert.NoError(t, spoke.ConvertTo(dst))
+	assert.Equal(t, src, dst)
+
+	// the fields changed in v1 win over the stored v2 spec
+	spoke.Spec.Env = map[string]string{"PORT": "81"}
+	spoke.Spec.Port = 81
+	dst = &v2.EasyHttp{}
+	assert.NoError(t, spoke.ConvertTo(dst))
+	assert.Equal(t, []v2.EnvVar{{Name: "PORT", Value: "81"}}, dst.Spec.Container.Env)
+	assert.Equal(t, int32(81), dst.Spec.Container.Port)
+	assert.Equal(t, src.Spec.Routes, dst.Spec.Routes)
+	assert.Empty(t, dst.Annotations)
+}
+
+func TestConvertV2EnvSources(t *testing.T) {
+	password := v2.EnvVar{Name: "PASSWORD", ValueFrom: &v2.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}}}
+
+	src := &v2.EasyHttp{}
+	src.Name = "kuard-1"
+	src.Spec.Host = "example.net"
+	src.Spec.Container.Image = "nginx"
+	src.Spec.Container.Env = []v2.EnvVar{{Name: "MODE", Value: "prod"}, password}
+	src.Spec.Container.EnvFrom = []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}}}
+
+	// only the plain values are represented in v1
+	spoke := &EasyHttp{}
+	assert.NoError(t, spoke.ConvertFrom(src))
+	assert.Equal(t, map[string]string{"MODE": "prod"}, spoke.Spec.Env)
+
+	dst := &v2.EasyHttp{}
+	assert.NoError(t, spoke.ConvertTo(dst))
+	assert.Equal(t, src, dst)
+
+	// the value sources are kept when the env is changed in v1
+	spoke.Spec.Env = map[string]string{"MODE": "dev"}
+	dst = &v2.EasyHttp{}
+	assert.NoError(t, spoke.ConvertTo(dst))
+	assert.Equal(t, []v2.EnvVar{{Name: "MODE", Value: "dev"}, password}, dst.Spec.Container.Env)
+	assert.Equal(t, src.Spec.Container.EnvFrom, dst.Spec.Container.EnvFrom)
+
+	// plain value in v1 overrides the value source
+	spoke.Spec.Env = map[string]string{"MODE": "dev", "PASSWORD": "secret"}
+	dst = &v2.EasyHttp{}
+	assert.NoError(t, spoke.ConvertTo(dst))
+	assert.Equal(t, []v2.EnvVar{{Name: "MODE", Value: "dev"}, {Name: "PASSWORD", Value: "secret"}}, dst.Spec.Container.Env)
+}
+
+func TestConvertV2Status(t *testing.T) {
+	var replicas int32 = 2
+
+	src := &v2.EasyHttp{}
+	src.Name = "kuard-1"
+	src.Spec = v2.EasyHttpSpec{
+		Host:      "example.net",
+		Container: v2.ContainerSpec{Image: "nginx", Tag: "1.23", Port: 80},
+		Scaling:   v2.ScalingSpec{Replicas: &replicas},
+		Strategy:  v2.StrategySpec{Type: v2.StrategyBlueGreen},
+	}
+	src.Status = v2.EasyHttpStatus{
+		Conditions:         []metav1.Condition{{Type: v2.ConditionReady, Status: metav1.ConditionTrue}},
+		ReadyReplicas:      1,
+		Selector:           "app=kuard-1-blue",
+		CurrentRevision:    "kuard-1-abc",
+		LastGoodSpec:       src.Spec.DeepCopy(),
+		RolledBackRevision: "kuard-1-def",
+		BlueGreen:          &v2.BlueGreenStatus{ActiveColor: v2.ColorBlue, ActiveSpec: src.Spec.DeepCopy()},
+	}
+
+	spoke := &EasyHttp{}
+	assert.NoError(t, spoke.ConvertFrom(src))
+	assert.Contains(t, spoke.Annotations, AnnotationV2Status)
+	// the converted objects do not share the replicas
+	*spoke.Spec.Replicas = 5
+	assert.Equal(t, int32(2), *src.Spec.Scaling.Replicas)
+	*spoke.Spec.Replicas = 2
+
+	// a status written as v1 keeps the v2 status fields
+	spoke.Status.ReadyReplicas = 2
+	dst := &v2.EasyHttp{}
+	assert.NoError(t, spoke.ConvertTo(dst))
+	expected := src.Status.DeepCopy()
+	expected.ReadyReplicas = 2
+	assert.Equal(t, *expected, dst.Status)
+	assert.NotContains(t, dst.Annotations, AnnotationV2Status)
+
+	// the v2 status is not stored when v1 can represent it
+	src.Status = v2.EasyHttpStatus{ReadyReplicas: 1}
+	spoke = &EasyHttp{}
+	assert.NoError(t, spoke.ConvertFrom(src))
+	assert.NotContains(t, spoke.Annotations, AnnotationV2Status)
+}
@@ -46,58 +46,46 @@ type EasyHttpSpec struct {
 	// Path is  where the application can be called (from outside). Currently supported only in nginx ingress!
 	// +kubebuilder:validation:optional
 	Path string `json:"path,omitempty"`
-}
-
-func nvl(v *int32) int32 {
-	if v == nil {
-		return 1
-	}
-	return *v
-}
-
-func (e *EasyHttpSpec) IsEqual(o *EasyHttpSpec) bool {
-	ret := e.Host == o.Host &&
-		e.Image == o.Image &&
-		e.ImageTag == o.ImageTag &&
-		e.Port == o.Port &&
-		e.CertManInssuer == o.CertManInssuer &&
-		e.Path == o.Path &&
-		nvl(e.Replicas) == nvl(o.Replicas)
-	if !ret {
-		return ret
-	}
-	if len(e.Env) != len(o.Env) {
-		return false
-	}
-	for k, v := range e.Env {
-		v2, has := o.Env[k]
-		if !has {
-			return false
-		}
-		if v != v2 {
-			return false
-		}
-	}
-	return true
-
+	// IngressClassName is the class of the ingress. The default ingress class of the cluster is used when empty.
+	// +kubebuilder:validation:optional
+	IngressClassName string `json:"ingressClassName,omitempty"`
 }
 
 // EasyHttpStatus defines the observed state of EasyHttp
 type EasyHttpStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	// IsDeployOK flag for status of deployment
-	IsDeployOK bool `json:"is_deploy_ok,omitempty"`
-	// IsSvcOK flag for status of service
-	IsSvcOK bool `json:"is_svc_ok,omitempty"`
-	// IsIngressOK flag for status of ingress setup
-	IsIngressOK bool `json:"is_ingress_ok,omitempty"`
-	// IsCertOK flag for status of cert-manager setup
-	Spec EasyHttpSpec `json:"spec,omitempty"`
+
+	// Conditions are the latest observations of the managed resources (DeploymentReady, ServiceReady,
+	// IngressReady, CertificateReady and the aggregated Ready)
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// DesiredReplicas is the number of replicas requested from the application deployment
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+	// Replicas is the number of pods (of any revision) of the application deployment
+	Replicas int32 `json:"replicas,omitempty"`
+	// UpdatedReplicas is the number of pods running the current revision of the application deployment
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+	// ReadyReplicas is the number of ready pods of the application deployment
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// AvailableReplicas is the number of available pods of the application deployment
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+	// ObservedGeneration is the metadata.generation of the EasyHttp the managed resources were last reconciled with
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.host`
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredReplicas`
+//+kubebuilder:printcolumn:name="Available",type=integer,JSONPath=`.status.availableReplicas`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // EasyHttp is the Schema for the easyhttps API
 type EasyHttp struct {
@@ -0,0 +1,521 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// EasyHttpSpec defines the desired state of EasyHttp
+type EasyHttpSpec struct {
+	// Host where the application is accesible from outside. Base of the Ingress route and certificate request
+	Host string `json:"host"`
+	// Aliases are the other hosts the application is accessible from, the certificate of the host covers them too
+	// +optional
+	Aliases []string `json:"aliases,omitempty"`
+	// RedirectAliases redirects the requests of the aliases to the host permanently instead of routing them to the application.
+	// The redirect is done by ingress-nginx, it requires the nginx IngressProvider.
+	// +optional
+	RedirectAliases bool `json:"redirectAliases,omitempty"`
+	// IngressClassName is the class of the ingress. The default ingress class of the cluster is used when empty.
+	// +optional
+	IngressClassName string `json:"ingressClassName,omitempty"`
+	// IngressProvider is the ingress controller serving the ingress class, it determines how the routes are rewritten.
+	// Default is nginx.
+	// +kubebuilder:validation:Enum=nginx;traefik;haproxy;none
+	// +optional
+	IngressProvider string `json:"ingressProvider,omitempty"`
+	// Container is the application container
+	Container ContainerSpec `json:"container"`
+	// Routes are the paths of the host routed to the application, each of them can be served by a different port of the container
+	// +optional
+	Routes []RouteSpec `json:"routes,omitempty"`
+	// TLS configures the certificate of the host
+	// +optional
+	TLS TLSSpec `json:"tls,omitempty"`
+	// Scaling configures the number of the application pods
+	// +optional
+	Scaling ScalingSpec `json:"scaling,omitempty"`
+	// Probes configures the health checks of the application container
+	// +optional
+	Probes ProbesSpec `json:"probes,omitempty"`
+	// Resources configures the compute resources of the application container
+	// +optional
+	Resources ResourcesSpec `json:"resources,omitempty"`
+	// Strategy configures how the pods are replaced when the application is updated
+	// +optional
+	Strategy StrategySpec `json:"strategy,omitempty"`
+	// Canary runs a new image tag next to the application and routes a part of the requests to it. The canary ingress is
+	// an ingress-nginx one, it requires the nginx IngressProvider.
+	// +optional
+	Canary *CanarySpec `json:"canary,omitempty"`
+	// DisruptionBudget configures the PodDisruptionBudget of the application pods.
+	// A budget with maxUnavailable 1 is created when it is not set and the application can have more than one pod.
+	// +optional
+	DisruptionBudget *DisruptionBudgetSpec `json:"disruptionBudget,omitempty"`
+	// RevisionHistoryLimit is the number of the revisions of the spec kept for rollback (default: 10)
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+}
+
+// ContainerSpec defines the application container
+type ContainerSpec struct {
+	// Image of the application without tag
+	Image string `json:"image"`
+	// Tag version tag of image
+	// +optional
+	Tag string `json:"tag,omitempty"`
+	// Port where the application is listening
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// ServicePort is the port of the service of the application, default is Port
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	ServicePort int32 `json:"servicePort,omitempty"`
+	// Env is the list of environment variables of the application
+	// +optional
+	Env []EnvVar `json:"env,omitempty"`
+	// EnvFrom is the list of ConfigMaps and Secrets whose keys are all set as environment variables
+	// +optional
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+}
+
+// EnvVar is an environment variable of the application container
+type EnvVar struct {
+	// Name of the environment variable
+	Name string `json:"name"`
+	// Value of the environment variable
+	// +optional
+	Value string `json:"value,omitempty"`
+	// ValueFrom is the source of the value, cannot be used with Value
+	// +optional
+	ValueFrom *EnvVarSource `json:"valueFrom,omitempty"`
+}
+
+// EnvVarSource is the source of the value of an environment variable, exactly one of the fields must be set
+type EnvVarSource struct {
+	// SecretKeyRef selects a key of a Secret in the namespace of the EasyHttp
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// ConfigMapKeyRef selects a key of a ConfigMap in the namespace of the EasyHttp
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// FieldRef selects a field of the pod (downward API), e.g. metadata.name or status.podIP
+	// +optional
+	FieldRef *corev1.ObjectFieldSelector `json:"fieldRef,omitempty"`
+}
+
+// RouteSpec defines a path routed to the application
+type RouteSpec struct {
+	// Path is where the application can be called (from outside), rewritten to the root of the container by default.
+	// The rewrite is implemented by the ingress provider.
+	Path string `json:"path"`
+	// PathType is the type of the path of the ingress (default: Prefix). The ImplementationSpecific paths are passed to
+	// the ingress controller as they are.
+	// +optional
+	// +kubebuilder:validation:Enum=Prefix;Exact;ImplementationSpecific
+	PathType *netv1.PathType `json:"pathType,omitempty"`
+	// Port of the container the requests of the route are sent to (default: container.port)
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+	// Rewrite removes the path from the requests, so the route is served from the root of the container. It is the
+	// default for the Prefix paths other than '/', it cannot be used with the other path types.
+	// +optional
+	Rewrite *bool `json:"rewrite,omitempty"`
+}
+
+// TLSSpec defines the certificate of the host
+type TLSSpec struct {
+	// Issuer of cert manager (e.g 'letsencrypt-prod'). Cert manager is disabled when empty.
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// ScalingSpec defines the number of the application pods
+type ScalingSpec struct {
+	// Replicas of the HTTP server application, not used when autoscaling is on
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Autoscaling makes the operator manage a HorizontalPodAutoscaler of the application deployment
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+}
+
+// AutoscalingSpec defines the HorizontalPodAutoscaler of the application deployment.
+// The CPU utilization target of Kubernetes (80%) is used when no target is set.
+type AutoscalingSpec struct {
+	// MinReplicas is the lower limit of the number of pods, 1 when not set
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the upper limit of the number of pods
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetCPUUtilizationPercentage is the target average CPU utilization of the pods relative to their CPU requests
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// TargetMemoryUtilizationPercentage is the target average memory utilization of the pods relative to their memory requests
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+	// Metrics are custom metrics (pods, object or external metrics) added to the CPU and memory targets
+	// +optional
+	Metrics []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+}
+
+// CanarySpec defines the canary release of a new image tag. The canary gets the requests selected by Weight, Header or Cookie
+// through a canary ingress of nginx. It is promoted or aborted with the httpapi.github.com/action annotation.
+type CanarySpec struct {
+	// Tag is the image tag of the canary pods
+	Tag string `json:"tag"`
+	// Replicas of the canary deployment
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Weight is the percentage of the requests routed to the canary
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight,omitempty"`
+	// Header is the name of the request header routing the request to the canary when its value is 'always' (or HeaderValue)
+	// and to the application when it is 'never'
+	// +optional
+	Header string `json:"header,omitempty"`
+	// HeaderValue is the value of Header routing the request to the canary
+	// +optional
+	HeaderValue string `json:"headerValue,omitempty"`
+	// Cookie is the name of the cookie routing the request to the canary when its value is 'always' and to the application
+	// when it is 'never'
+	// +optional
+	Cookie string `json:"cookie,omitempty"`
+}
+
+// StrategyBlueGreen runs the application in two deployments (blue and green). A new spec is rolled out to the idle one
+// (the preview) and the ingress is switched to it when it is ready and its promotion has been requested. The failed rollouts
+// are not rolled back automatically, the failed preview is not promoted and the active color keeps serving.
+const StrategyBlueGreen appsv1.DeploymentStrategyType = "BlueGreen"
+
+// Ingress providers, the ingress controllers whose path rewriting is supported
+const (
+	// IngressProviderNginx rewrites the paths with the regular expressions of ingress-nginx
+	IngressProviderNginx = "nginx"
+	// IngressProviderTraefik strips the prefixes of the paths with a Traefik middleware
+	IngressProviderTraefik = "traefik"
+	// IngressProviderHAProxy rewrites the paths with the path-rewrite annotation of the HAProxy ingress controller
+	IngressProviderHAProxy = "haproxy"
+	// IngressProviderNone routes the requests without rewriting their paths
+	IngressProviderNone = "none"
+)
+
+// Colors of the deployments of the BlueGreen strategy
+const (
+	ColorBlue  = "blue"
+	ColorGreen = "green"
+)
+
+// StrategySpec defines the deployment strategy of the application
+type StrategySpec struct {
+	// Type of the strategy. RollingUpdate is used when the application can have more than one pod, Recreate otherwise.
+	// BlueGreen rolls out a new spec to a preview deployment which replaces the active one when it is promoted, a failed
+	// preview is not rolled back automatically.
+	// +optional
+	// +kubebuilder:validation:Enum=RollingUpdate;Recreate;BlueGreen
+	Type appsv1.DeploymentStrategyType `json:"type,omitempty"`
+	// MaxSurge is the number or percentage of the pods which can be created above the desired number during a rolling update
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+	// MaxUnavailable is the number or percentage of the pods which can be unavailable during a rolling update
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// MinReadySeconds is the time a new pod must be ready to be considered available
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+	// ProgressDeadlineSeconds is the time after the rollout is reported as failed (ProgressDeadlineExceeded) when it does not progress
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+}
+
+// DisruptionBudgetSpec defines the number of the application pods which can be evicted at the same time (e.g. by node drains).
+// At most one of MinAvailable and MaxUnavailable can be set, maxUnavailable 1 is used when none of them is set.
+type DisruptionBudgetSpec struct {
+	// MinAvailable is the number or percentage of the pods which must be available after an eviction
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// MaxUnavailable is the number or percentage of the pods which can be unavailable after an eviction
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// ResourcesSpec defines the compute resources (cpu, memory and ephemeral-storage) of the application container
+type ResourcesSpec struct {
+	// Preset is the name of a size preset configured in the operator (small, medium and large by default).
+	// The explicitly set requests and limits take precedence over the ones of the preset.
+	// +optional
+	Preset string `json:"preset,omitempty"`
+	// Requests are the minimum amounts of the resources reserved for the container
+	// +optional
+	Requests corev1.ResourceList `json:"requests,omitempty"`
+	// Limits are the maximum amounts of the resources the container can use
+	// +optional
+	Limits corev1.ResourceList `json:"limits,omitempty"`
+}
+
+// ProbesSpec defines the liveness, readiness and startup probes of the application container
+type ProbesSpec struct {
+	// HealthPath is a shortcut generating HTTP GET readiness and liveness probes on this path of the application port.
+	// The explicitly set Readiness and Liveness probes take precedence.
+	// +optional
+	HealthPath string `json:"healthPath,omitempty"`
+	// Liveness probe, the container is restarted when it fails
+	// +optional
+	Liveness *Probe `json:"liveness,omitempty"`
+	// Readiness probe, the pod does not get traffic while it fails
+	// +optional
+	Readiness *Probe `json:"readiness,omitempty"`
+	// Startup probe, the other probes are started only after it has succeeded
+	// +optional
+	Startup *Probe `json:"startup,omitempty"`
+}
+
+// Probe is a health check of the application container, exactly one of HTTPGet, TCPSocket and Exec must be set.
+// The timings and thresholds of Kubernetes are used when they are not set.
+type Probe struct {
+	// HTTPGet checks an HTTP endpoint of the application
+	// +optional
+	HTTPGet *HTTPGetProbe `json:"httpGet,omitempty"`
+	// TCPSocket checks if a TCP port of the application is open
+	// +optional
+	TCPSocket *TCPSocketProbe `json:"tcpSocket,omitempty"`
+	// Exec runs a command in the application container
+	// +optional
+	Exec *ExecProbe `json:"exec,omitempty"`
+	// InitialDelaySeconds is the delay after the start of the container before the first check
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	// TimeoutSeconds is the timeout of a check
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// PeriodSeconds is the time between the checks
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// SuccessThreshold is the number of consecutive successful checks to be considered healthy after a failure
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+	// FailureThreshold is the number of consecutive failed checks to be considered unhealthy
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// HTTPGetProbe checks an HTTP endpoint of the application, the check succeeds on a 2xx or 3xx response
+type HTTPGetProbe struct {
+	// Path of the endpoint, the root of the application when empty
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Port of the endpoint, the port of the application when not set
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// TCPSocketProbe checks if a TCP port of the application is open
+type TCPSocketProbe struct {
+	// Port to connect to, the port of the application when not set
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// ExecProbe runs a command in the application container, the check succeeds when the command exits with 0
+type ExecProbe struct {
+	// Command to run, it is not run in a shell
+	Command []string `json:"command"`
+}
+
+// AnnotationAction requests a one-off operation on the EasyHttp, it is removed by the operator when the operation is done
+const AnnotationAction = "httpapi.github.com/action"
+
+// AnnotationRollbackTo requests the rollback of the spec to a revision, its value is the name or the number of the revision.
+// It is removed by the operator when the spec has been rolled back.
+const AnnotationRollbackTo = "httpapi.github.com/rollback-to"
+
+// Operations requested with AnnotationAction
+const (
+	// ActionPromote replaces the image tag of the application with the tag of the canary and removes the canary.
+	// With the BlueGreen strategy it switches the ingress to the preview when it is ready.
+	ActionPromote = "promote"
+	// ActionAbort removes the canary
+	ActionAbort = "abort"
+)
+
+// Condition types reported in EasyHttpStatus.Conditions
+const (
+	// ConditionDeploymentReady is true when the rollout of the application deployment has been completed
+	ConditionDeploymentReady = "DeploymentReady"
+	// ConditionServiceReady is true when the application service has been reconciled
+	ConditionServiceReady = "ServiceReady"
+	// ConditionIngressReady is true when the ingress route has been reconciled
+	ConditionIngressReady = "IngressReady"
+	// ConditionCertificateReady is true when the TLS secret has been issued or cert manager is disabled
+	ConditionCertificateReady = "CertificateReady"
+	// ConditionAutoscalerReady is true when the HorizontalPodAutoscaler has been reconciled or autoscaling is off
+	ConditionAutoscalerReady = "AutoscalerReady"
+	// ConditionDisruptionBudgetReady is true when the PodDisruptionBudget has been reconciled or it is not required
+	ConditionDisruptionBudgetReady = "DisruptionBudgetReady"
+	// ConditionCanaryReady is true when the rollout of the canary has been completed or there is no canary
+	ConditionCanaryReady = "CanaryReady"
+	// ConditionPreviewReady is true when the rollout of the blue/green preview has been completed or there is no preview
+	ConditionPreviewReady = "PreviewReady"
+	// ConditionRolledBack is true when the rollout of the current spec has failed and the application deployment has been
+	// rolled back to the last spec which has been rolled out successfully. The application is not Ready while it is true.
+	ConditionRolledBack = "RolledBack"
+	// ConditionReady is true when all the other conditions are true
+	ConditionReady = "Ready"
+)
+
+// Condition reasons reported in EasyHttpStatus.Conditions
+const (
+	ReasonCreated           = "Created"
+	ReasonUpdated           = "Updated"
+	ReasonInSync            = "InSync"
+	ReasonDriftCorrected    = "DriftCorrected"
+	ReasonSpecChanged       = "SpecChanged"
+	ReasonConfigChanged     = "ConfigChanged"
+	ReasonReconcileFailed   = "ReconcileFailed"
+	ReasonCertIssued        = "Issued"
+	ReasonCertPending       = "Pending"
+	ReasonCertDisabled      = "Disabled"
+	ReasonAutoscalerOff     = "AutoscalingOff"
+	ReasonNotRequired       = "NotRequired"
+	ReasonNoCanary          = "NoCanary"
+	ReasonCanaryPromoted    = "CanaryPromoted"
+	ReasonCanaryAborted     = "CanaryAborted"
+	ReasonActionIgnored     = "ActionIgnored"
+	ReasonNoPreview         = "NoPreview"
+	ReasonPromotionPending  = "PromotionPending"
+	ReasonPreviewPromoted   = "PreviewPromoted"
+	ReasonRolledBack        = "RolledBack"
+	ReasonNoRollback        = "NoRollback"
+	ReasonRevisionRestored  = "RevisionRestored"
+	ReasonDeleted           = "Deleted"
+	ReasonAllResourcesReady = "AllResourcesReady"
+	ReasonResourcesNotReady = "ResourcesNotReady"
+	ReasonRolloutInProgress = "RolloutInProgress"
+	ReasonRolloutComplete   = "RolloutComplete"
+	ReasonProgressDeadline  = "ProgressDeadlineExceeded"
+	ReasonReplicaFailure    = "ReplicaFailure"
+	ReasonCrashLoop         = "CrashLoopBackOff"
+)
+
+// EasyHttpStatus defines the observed state of EasyHttp
+type EasyHttpStatus struct {
+	// Conditions are the latest observations of the managed resources (DeploymentReady, ServiceReady,
+	// IngressReady, CertificateReady, AutoscalerReady, DisruptionBudgetReady, CanaryReady, PreviewReady, RolledBack and the aggregated Ready)
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// DesiredReplicas is the number of replicas requested from the application deployment
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+	// Replicas is the number of pods (of any revision) of the application deployment
+	Replicas int32 `json:"replicas,omitempty"`
+	// UpdatedReplicas is the number of pods running the current revision of the application deployment
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+	// ReadyReplicas is the number of ready pods of the application deployment
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// AvailableReplicas is the number of available pods of the application deployment
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+	// ObservedGeneration is the metadata.generation of the EasyHttp the managed resources were last reconciled with
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Selector is the label selector of the application pods, used by the scale subresource
+	Selector string `json:"selector,omitempty"`
+	// CurrentRevision is the name of the ControllerRevision the current spec is recorded in
+	// +optional
+	CurrentRevision string `json:"currentRevision,omitempty"`
+	// LastGoodSpec is the spec the rollout of the application deployment has last been completed with
+	// +optional
+	LastGoodSpec *EasyHttpSpec `json:"lastGoodSpec,omitempty"`
+	// RolledBackRevision is the name of the revision of the spec whose rollout has failed and has been rolled back to
+	// LastGoodSpec. The rollout is retried when the spec changes, scaling the application does not retry it.
+	// +optional
+	RolledBackRevision string `json:"rolledBackRevision,omitempty"`
+	// BlueGreen is the state of the BlueGreen strategy, it is removed when another strategy is used
+	// +optional
+	BlueGreen *BlueGreenStatus `json:"blueGreen,omitempty"`
+}
+
+// BlueGreenStatus defines the observed state of the BlueGreen strategy
+type BlueGreenStatus struct {
+	// ActiveColor is the color of the deployment the ingress routes the requests to
+	// +kubebuilder:validation:Enum=blue;green
+	ActiveColor string `json:"activeColor"`
+	// ActiveSpec is the spec the active deployment has been rolled out with
+	// +optional
+	ActiveSpec *EasyHttpSpec `json:"activeSpec,omitempty"`
+	// PromotionRequested is true when the preview has to become active as soon as it is ready
+	// +optional
+	PromotionRequested bool `json:"promotionRequested,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:subresource:scale:specpath=.spec.scaling.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.host`
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredReplicas`
+//+kubebuilder:printcolumn:name="Available",type=integer,JSONPath=`.status.availableReplicas`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EasyHttp is the Schema for the easyhttps API
+type EasyHttp struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EasyHttpSpec   `json:"spec,omitempty"`
+	Status EasyHttpStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// EasyHttpList contains a list of EasyHttp
+type EasyHttpList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EasyHttp `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EasyHttp{}, &EasyHttpList{})
+}
@@ -0,0 +1,740 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var easyhttplog = logf.Log.WithName("easyhttp-resource")
+
+var (
+	// imageRegexp matches an image repository reference without tag and digest, e.g. 'gcr.io/kuar-demo/kuard-amd64'
+	imageRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?/)?` +
+		`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	// imageTagRegexp matches a valid image tag
+	imageTagRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+	// pathRegexp matches the paths which can be embedded into the rewrite regex of the ingress
+	pathRegexp = regexp.MustCompile(`^(/[a-zA-Z0-9_~%-]+)+$`)
+	// cookieRegexp matches a cookie name (an HTTP token)
+	cookieRegexp = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+	// percentRegexp matches a percentage, e.g. '25%'
+	percentRegexp = regexp.MustCompile(`^[0-9]+%$`)
+)
+
+// Defaults of the EasyHttp fields
+const (
+	DefaultReplicas int32 = 1
+	DefaultImageTag       = "latest"
+	DefaultPath           = "/"
+	DefaultPort     int32 = 8080
+	// DefaultRevisionHistoryLimit is applied by the operator, the limit is not stored in the spec
+	DefaultRevisionHistoryLimit int32 = 10
+)
+
+// SetupWebhookWithManager registers the webhooks of EasyHttp in the manager
+func (r *EasyHttp) SetupWebhookWithManager(mgr ctrl.Manager, defaulter *EasyHttpDefaulter) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(defaulter).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-httpapi-github-com-v2-easyhttp,mutating=true,failurePolicy=fail,sideEffects=None,groups=httpapi.github.com,resources=easyhttps,verbs=create;update,versions=v2,name=measyhttp.kb.io,admissionReviewVersions=v1
+
+// EasyHttpDefaulter fills in the defaults of EasyHttp, the cluster specific ones come from the operator configuration
+// and are filled in on creation
+// +kubebuilder:object:generate=false
+type EasyHttpDefaulter struct {
+	// IngressClassName is the default ingress class, not set when empty
+	IngressClassName string
+	// CertManIssuer is the default issuer of cert manager, not set when empty
+	CertManIssuer string
+	// IngressProvider is the default ingress provider, not set when empty
+	IngressProvider string
+}
+
+var _ admission.CustomDefaulter = &EasyHttpDefaulter{}
+
+// Default implements admission.CustomDefaulter so a webhook will be registered for the type
+func (d *EasyHttpDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*EasyHttp)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected an EasyHttp but got a %T", obj))
+	}
+	easyhttplog.Info("default", "name", r.Name)
+
+	if r.Spec.Scaling.Replicas == nil {
+		replicas := DefaultReplicas
+		r.Spec.Scaling.Replicas = &replicas
+	}
+	if r.Spec.Container.Tag == "" {
+		r.Spec.Container.Tag = DefaultImageTag
+	}
+	if r.Spec.Container.Port == 0 {
+		r.Spec.Container.Port = DefaultPort
+	}
+	if len(r.Spec.Routes) == 0 {
+		r.Spec.Routes = []RouteSpec{{Path: DefaultPath}}
+	}
+	// the cluster specific defaults are set on creation only, so they can be cleared later (e.g. to turn TLS off)
+	if req, err := admission.RequestFromContext(ctx); err == nil && req.Operation != admissionv1.Create {
+		return nil
+	}
+	if r.Spec.IngressClassName == "" {
+		r.Spec.IngressClassName = d.IngressClassName
+	}
+	if r.Spec.TLS.Issuer == "" {
+		r.Spec.TLS.Issuer = d.CertManIssuer
+	}
+	if r.Spec.IngressProvider == "" {
+		r.Spec.IngressProvider = d.IngressProvider
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-httpapi-github-com-v2-easyhttp,mutating=false,failurePolicy=fail,sideEffects=None,groups=httpapi.github.com,resources=easyhttps,verbs=create;update,versions=v2,name=veasyhttp.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &EasyHttp{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *EasyHttp) ValidateCreate() error {
+	easyhttplog.Info("validate create", "name", r.Name)
+
+	return r.toInvalid(r.validateSpec())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *EasyHttp) ValidateUpdate(old runtime.Object) error {
+	easyhttplog.Info("validate update", "name", r.Name)
+
+	oldResource, ok := old.(*EasyHttp)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected an EasyHttp but got a %T", old))
+	}
+	allErrs := r.validateSpec()
+	allErrs = append(allErrs, validateHostUpdate(r.Spec.Host, &oldResource.Spec, field.NewPath("spec", "host"))...)
+	return r.toInvalid(allErrs)
+}
+
+// validateHostUpdate validates that the host is changed only to one of the previous aliases, so the application stays
+// reachable on the new host while its ingress and certificate are replaced
+func validateHostUpdate(host string, oldSpec *EasyHttpSpec, fldPath *field.Path) field.ErrorList {
+	if host == oldSpec.Host {
+		return nil
+	}
+	for _, alias := range oldSpec.Aliases {
+		if host == alias {
+			return nil
+		}
+	}
+	return field.ErrorList{field.Forbidden(fldPath, "may be changed only to one of the previous aliases")}
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *EasyHttp) ValidateDelete() error {
+	return nil
+}
+
+// toInvalid converts the field errors into an Invalid API error, nil when there is no error
+func (r *EasyHttp) toInvalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("EasyHttp").GroupKind(), r.Name, allErrs)
+}
+
+// validateSpec validates the fields of the spec
+func (r *EasyHttp) validateSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	allErrs = append(allErrs, validateHost(r.Spec.Host, specPath.Child("host"))...)
+	allErrs = append(allErrs, validateAliases(&r.Spec, specPath)...)
+	allErrs = append(allErrs, validateContainer(&r.Spec.Container, specPath.Child("container"))...)
+	allErrs = append(allErrs, validateRoutes(r.Spec.Routes, &r.Spec.Container, specPath.Child("routes"))...)
+	allErrs = append(allErrs, validateProbes(&r.Spec.Probes, specPath.Child("probes"))...)
+	allErrs = append(allErrs, validateResources(&r.Spec.Resources, specPath.Child("resources"))...)
+	allErrs = append(allErrs, validateStrategy(&r.Spec.Strategy, specPath.Child("strategy"))...)
+	if r.Spec.Strategy.Type == StrategyBlueGreen {
+		allErrs = append(allErrs, validateBlueGreen(&r.Spec, specPath)...)
+	}
+	if r.Spec.Canary != nil {
+		allErrs = append(allErrs, validateCanary(r.Spec.Canary, specPath.Child("canary"))...)
+	}
+	if r.Spec.DisruptionBudget != nil {
+		allErrs = append(allErrs, validateDisruptionBudget(r.Spec.DisruptionBudget, specPath.Child("disruptionBudget"))...)
+	}
+	if r.Spec.Scaling.Replicas != nil && *r.Spec.Scaling.Replicas < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("scaling", "replicas"), *r.Spec.Scaling.Replicas, validation.InclusiveRangeError(0, 2147483647)))
+	}
+	if r.Spec.Scaling.Autoscaling != nil {
+		allErrs = append(allErrs, validateAutoscaling(r.Spec.Scaling.Autoscaling, specPath.Child("scaling", "autoscaling"))...)
+	}
+	if r.Spec.RevisionHistoryLimit != nil && *r.Spec.RevisionHistoryLimit < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("revisionHistoryLimit"), *r.Spec.RevisionHistoryLimit, validation.InclusiveRangeError(1, 2147483647)))
+	}
+	if r.Spec.TLS.Issuer != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(r.Spec.TLS.Issuer) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("tls", "issuer"), r.Spec.TLS.Issuer, msg))
+		}
+		allErrs = append(allErrs, validateCertificateHosts(&r.Spec, specPath)...)
+	}
+	if r.Spec.IngressClassName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(r.Spec.IngressClassName) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("ingressClassName"), r.Spec.IngressClassName, msg))
+		}
+	}
+	allErrs = append(allErrs, validateIngressProvider(&r.Spec, specPath)...)
+	return allErrs
+}
+
+// validateIngressProvider validates that the features of the spec are supported by its ingress provider. The canary and
+// the redirect of the aliases are implemented with the annotations of ingress-nginx.
+func validateIngressProvider(spec *EasyHttpSpec, specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch spec.IngressProvider {
+	case "", IngressProviderNginx:
+		return nil
+	case IngressProviderTraefik, IngressProviderHAProxy, IngressProviderNone:
+	default:
+		return field.ErrorList{field.NotSupported(specPath.Child("ingressProvider"), spec.IngressProvider,
+			[]string{IngressProviderNginx, IngressProviderTraefik, IngressProviderHAProxy, IngressProviderNone})}
+	}
+	msg := fmt.Sprintf("may not be specified with the %s ingress provider", spec.IngressProvider)
+	if spec.Canary != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("canary"), msg))
+	}
+	if spec.RedirectAliases {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("redirectAliases"), msg))
+	}
+	if spec.IngressProvider == IngressProviderNone {
+		for i, route := range spec.Routes {
+			if route.Rewrite != nil && *route.Rewrite {
+				allErrs = append(allErrs, field.Forbidden(specPath.Child("routes").Index(i).Child("rewrite"), msg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateContainer validates the image, ports and environment variables of the application container
+func validateContainer(container *ContainerSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := validateImage(container.Image, container.Tag, fldPath)
+	if container.Port < 1 || container.Port > 65535 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), container.Port, validation.InclusiveRangeError(1, 65535)))
+	}
+	if container.ServicePort < 0 || container.ServicePort > 65535 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("servicePort"), container.ServicePort, validation.InclusiveRangeError(0, 65535)))
+	}
+	names := make(map[string]bool, len(container.Env))
+	for i, env := range container.Env {
+		envPath := fldPath.Child("env").Index(i)
+		for _, msg := range validation.IsEnvVarName(env.Name) {
+			allErrs = append(allErrs, field.Invalid(envPath.Child("name"), env.Name, msg))
+		}
+		if names[env.Name] {
+			allErrs = append(allErrs, field.Duplicate(envPath.Child("name"), env.Name))
+		}
+		names[env.Name] = true
+		if env.ValueFrom != nil {
+			if env.Value != "" {
+				allErrs = append(allErrs, field.Invalid(envPath.Child("valueFrom"), "", "may not be specified when `value` is not empty"))
+			}
+			allErrs = append(allErrs, validateEnvVarSource(env.ValueFrom, envPath.Child("valueFrom"))...)
+		}
+	}
+	for i, envFrom := range container.EnvFrom {
+		allErrs = append(allErrs, validateEnvFromSource(&envFrom, fldPath.Child("envFrom").Index(i))...)
+	}
+	return allErrs
+}
+
+// validateEnvVarSource validates that exactly one complete source is set
+func validateEnvVarSource(source *EnvVarSource, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	sources := 0
+	if ref := source.SecretKeyRef; ref != nil {
+		sources++
+		allErrs = append(allErrs, validateKeyRef(ref.Name, ref.Key, fldPath.Child("secretKeyRef"))...)
+	}
+	if ref := source.ConfigMapKeyRef; ref != nil {
+		sources++
+		allErrs = append(allErrs, validateKeyRef(ref.Name, ref.Key, fldPath.Child("configMapKeyRef"))...)
+	}
+	if ref := source.FieldRef; ref != nil {
+		sources++
+		if ref.FieldPath == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("fieldRef", "fieldPath"), "field path of the pod is required"))
+		}
+	}
+	if sources != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", "must specify exactly one of: `secretKeyRef`, `configMapKeyRef` or `fieldRef`"))
+	}
+	return allErrs
+}
+
+// validateKeyRef validates the name and the key of a referenced Secret or ConfigMap
+func validateKeyRef(name, key string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateRefName(name, fldPath.Child("name"))...)
+	if key == "" {
+		return append(allErrs, field.Required(fldPath.Child("key"), "key is required"))
+	}
+	for _, msg := range validation.IsConfigMapKey(key) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("key"), key, msg))
+	}
+	return allErrs
+}
+
+// validateEnvFromSource validates that exactly one of the ConfigMap and the Secret is referenced
+func validateEnvFromSource(source *corev1.EnvFromSource, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if source.Prefix != "" {
+		for _, msg := range validation.IsEnvVarName(source.Prefix) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("prefix"), source.Prefix, msg))
+		}
+	}
+	sources := 0
+	if source.ConfigMapRef != nil {
+		sources++
+		allErrs = append(allErrs, validateRefName(source.ConfigMapRef.Name, fldPath.Child("configMapRef", "name"))...)
+	}
+	if source.SecretRef != nil {
+		sources++
+		allErrs = append(allErrs, validateRefName(source.SecretRef.Name, fldPath.Child("secretRef", "name"))...)
+	}
+	if sources != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", "must specify exactly one of: `configMapRef` or `secretRef`"))
+	}
+	return allErrs
+}
+
+// validateRefName validates the name of a referenced Secret or ConfigMap
+func validateRefName(name string, fldPath *field.Path) field.ErrorList {
+	if name == "" {
+		return field.ErrorList{field.Required(fldPath, "name is required")}
+	}
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+	}
+	return allErrs
+}
+
+// validateHost validates the host of the ingress rule, wildcard hosts (e.g. '*.example.com') are allowed
+func validateHost(host string, fldPath *field.Path) field.ErrorList {
+	if host == "" {
+		return field.ErrorList{field.Required(fldPath, "host of the ingress rule is required")}
+	}
+	var msgs []string
+	if strings.HasPrefix(host, "*.") {
+		msgs = validation.IsWildcardDNS1123Subdomain(host)
+	} else {
+		msgs = validation.IsDNS1123Subdomain(host)
+	}
+	var allErrs field.ErrorList
+	for _, msg := range msgs {
+		allErrs = append(allErrs, field.Invalid(fldPath, host, msg))
+	}
+	return allErrs
+}
+
+// validateCertificateHosts validates that the hosts of the certificate are not wildcards: they cannot be issued with the
+// HTTP-01 challenge of the ingress and they do not give a valid name of the TLS secret
+func validateCertificateHosts(spec *EasyHttpSpec, specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	msg := "wildcard hosts may not be used when `tls.issuer` is specified"
+	if strings.HasPrefix(spec.Host, "*.") {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("host"), msg))
+	}
+	for i, alias := range spec.Aliases {
+		if strings.HasPrefix(alias, "*.") {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("aliases").Index(i), msg))
+		}
+	}
+	return allErrs
+}
+
+// validateAliases validates that the aliases are unique hosts other than the host and they are redirected only when there are any
+func validateAliases(spec *EasyHttpSpec, specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	hosts := map[string]bool{spec.Host: true}
+	for i, alias := range spec.Aliases {
+		fldPath := specPath.Child("aliases").Index(i)
+		if hosts[alias] {
+			allErrs = append(allErrs, field.Duplicate(fldPath, alias))
+			continue
+		}
+		hosts[alias] = true
+		allErrs = append(allErrs, validateHost(alias, fldPath)...)
+	}
+	if spec.RedirectAliases && len(spec.Aliases) == 0 {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("redirectAliases"), "may not be specified without `aliases`"))
+	}
+	return allErrs
+}
+
+// validateRoutes validates that the paths of the routes are valid and unique, their ports are valid and only the Prefix paths
+// are rewritten. The service exposes the other ports of the routes on the same port, so they cannot be the service port.
+func validateRoutes(routes []RouteSpec, container *ContainerSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	paths := make(map[string]bool, len(routes))
+	for i, route := range routes {
+		routePath := fldPath.Index(i)
+		if paths[route.Path] {
+			allErrs = append(allErrs, field.Duplicate(routePath.Child("path"), route.Path))
+		}
+		paths[route.Path] = true
+		allErrs = append(allErrs, validatePath(route.Path, routePath.Child("path"))...)
+		if route.Port < 0 || route.Port > 65535 {
+			allErrs = append(allErrs, field.Invalid(routePath.Child("port"), route.Port, validation.InclusiveRangeError(0, 65535)))
+		}
+		if route.Port != 0 && route.Port != container.Port && route.Port == container.ServicePort {
+			allErrs = append(allErrs, field.Invalid(routePath.Child("port"), route.Port, "must not be `container.servicePort`"))
+		}
+		if route.Rewrite != nil && *route.Rewrite && route.PathType != nil && *route.PathType != netv1.PathTypePrefix {
+			allErrs = append(allErrs, field.Forbidden(routePath.Child("rewrite"), "may not be true when `pathType` is not 'Prefix'"))
+		}
+	}
+	return allErrs
+}
+
+// validatePath validates the path of the application. The path is embedded into the rewrite regex of the ingress,
+// so regex metacharacters and a trailing slash are not allowed.
+func validatePath(path string, fldPath *field.Path) field.ErrorList {
+	if path == "" || path == "/" || pathRegexp.MatchString(path) {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(fldPath, path,
+		"must be '/' or a sequence of '/<segment>' where a segment consists of alphanumeric characters, '-', '_', '~' or '%' "+
+			"(regex metacharacters and trailing '/' are not allowed)")}
+}
+
+// validateAutoscaling validates the replica limits and the metrics of the autoscaler
+func validateAutoscaling(autoscaling *AutoscalingSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if autoscaling.MaxReplicas < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxReplicas"), autoscaling.MaxReplicas, "must be greater than or equal to 1"))
+	}
+	if min := autoscaling.MinReplicas; min != nil {
+		if *min < 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("minReplicas"), *min, "must be greater than or equal to 1"))
+		} else if *min > autoscaling.MaxReplicas {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("minReplicas"), *min, "must be less than or equal to maxReplicas"))
+		}
+	}
+	if target := autoscaling.TargetCPUUtilizationPercentage; target != nil && *target < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("targetCPUUtilizationPercentage"), *target, "must be greater than or equal to 1"))
+	}
+	if target := autoscaling.TargetMemoryUtilizationPercentage; target != nil && *target < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("targetMemoryUtilizationPercentage"), *target, "must be greater than or equal to 1"))
+	}
+	for i, metric := range autoscaling.Metrics {
+		allErrs = append(allErrs, validateMetric(&metric, fldPath.Child("metrics").Index(i))...)
+	}
+	return allErrs
+}
+
+// validateMetric validates that the source of the metric type is set
+func validateMetric(metric *autoscalingv2.MetricSpec, fldPath *field.Path) field.ErrorList {
+	var set bool
+	switch metric.Type {
+	case autoscalingv2.PodsMetricSourceType:
+		set = metric.Pods != nil
+	case autoscalingv2.ObjectMetricSourceType:
+		set = metric.Object != nil
+	case autoscalingv2.ExternalMetricSourceType:
+		set = metric.External != nil
+	case autoscalingv2.ResourceMetricSourceType:
+		set = metric.Resource != nil
+	case autoscalingv2.ContainerResourceMetricSourceType:
+		set = metric.ContainerResource != nil
+	default:
+		return field.ErrorList{field.NotSupported(fldPath.Child("type"), metric.Type, []string{
+			string(autoscalingv2.PodsMetricSourceType), string(autoscalingv2.ObjectMetricSourceType), string(autoscalingv2.ExternalMetricSourceType),
+			string(autoscalingv2.ResourceMetricSourceType), string(autoscalingv2.ContainerResourceMetricSourceType)})}
+	}
+	if !set {
+		return field.ErrorList{field.Required(fldPath, fmt.Sprintf("source of the %s metric is required", metric.Type))}
+	}
+	return nil
+}
+
+// validateCanary validates the image tag, the replicas and the request selection of the canary
+func validateCanary(canary *CanarySpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if canary.Tag == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("tag"), "tag of the canary image is required"))
+	} else if !imageTagRegexp.MatchString(canary.Tag) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("tag"), canary.Tag,
+			"must consist of alphanumeric characters, '_', '.' or '-', must not start with '.' or '-' and must be at most 128 characters"))
+	}
+	if canary.Replicas != nil && *canary.Replicas < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("replicas"), *canary.Replicas, validation.InclusiveRangeError(0, 2147483647)))
+	}
+	if canary.Weight < 0 || canary.Weight > 100 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("weight"), canary.Weight, validation.InclusiveRangeError(0, 100)))
+	}
+	if canary.Header != "" {
+		for _, msg := range validation.IsHTTPHeaderName(canary.Header) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("header"), canary.Header, msg))
+		}
+	} else if canary.HeaderValue != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("headerValue"), "may not be specified without `header`"))
+	}
+	if canary.Cookie != "" && !cookieRegexp.MatchString(canary.Cookie) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("cookie"), canary.Cookie, "must be a valid cookie name"))
+	}
+	return allErrs
+}
+
+// validateStrategy validates that the rolling update parameters are set only for the RollingUpdate strategy
+func validateStrategy(strategy *StrategySpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		if strategy.MaxSurge != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("maxSurge"), "may not be specified when strategy `type` is 'Recreate'"))
+		}
+		if strategy.MaxUnavailable != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("maxUnavailable"), "may not be specified when strategy `type` is 'Recreate'"))
+		}
+		return allErrs
+	}
+	if strategy.MaxSurge != nil {
+		allErrs = append(allErrs, validateIntOrPercent(strategy.MaxSurge, fldPath.Child("maxSurge"))...)
+	}
+	if strategy.MaxUnavailable != nil {
+		allErrs = append(allErrs, validateIntOrPercent(strategy.MaxUnavailable, fldPath.Child("maxUnavailable"))...)
+	}
+	if isZero(strategy.MaxSurge) && isZero(strategy.MaxUnavailable) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxUnavailable"), strategy.MaxUnavailable.String(),
+			"may not be 0 when `maxSurge` is 0"))
+	}
+	return allErrs
+}
+
+// isZero returns true if value is set to 0 or 0%
+func isZero(value *intstr.IntOrString) bool {
+	return value != nil && (value.Type == intstr.Int && value.IntVal == 0 || value.Type == intstr.String && value.StrVal == "0%")
+}
+
+// validateBlueGreen validates that the features which need the pods of a single deployment are not used with the BlueGreen strategy.
+// The automatic rollback is not used by the BlueGreen strategy either: a failed preview is never promoted, it is replaced
+// by the next spec.
+func validateBlueGreen(spec *EasyHttpSpec, specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.Canary != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("canary"), "may not be specified when strategy `type` is 'BlueGreen'"))
+	}
+	if spec.Scaling.Autoscaling != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("scaling", "autoscaling"), "may not be specified when strategy `type` is 'BlueGreen'"))
+	}
+	if spec.DisruptionBudget != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("disruptionBudget"), "may not be specified when strategy `type` is 'BlueGreen'"))
+	}
+	return allErrs
+}
+
+// validateDisruptionBudget validates that at most one of minAvailable and maxUnavailable is set with a valid value
+func validateDisruptionBudget(budget *DisruptionBudgetSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if budget.MinAvailable != nil && budget.MaxUnavailable != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", "may not specify both `minAvailable` and `maxUnavailable`"))
+	}
+	if budget.MinAvailable != nil {
+		allErrs = append(allErrs, validateIntOrPercent(budget.MinAvailable, fldPath.Child("minAvailable"))...)
+	}
+	if budget.MaxUnavailable != nil {
+		allErrs = append(allErrs, validateIntOrPercent(budget.MaxUnavailable, fldPath.Child("maxUnavailable"))...)
+	}
+	return allErrs
+}
+
+// validateIntOrPercent validates that value is a non-negative integer or a percentage between 0% and 100%
+func validateIntOrPercent(value *intstr.IntOrString, fldPath *field.Path) field.ErrorList {
+	if value.Type == intstr.Int {
+		if value.IntVal < 0 {
+			return field.ErrorList{field.Invalid(fldPath, value.IntVal, "must be greater than or equal to 0")}
+		}
+		return nil
+	}
+	if !percentRegexp.MatchString(value.StrVal) {
+		return field.ErrorList{field.Invalid(fldPath, value.StrVal, "must be an integer or a percentage (e.g. '25%')")}
+	}
+	if percent, _ := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%")); percent > 100 {
+		return field.ErrorList{field.Invalid(fldPath, value.StrVal, "must not be greater than 100%")}
+	}
+	return nil
+}
+
+// validateResources validates the preset name and the requests and limits of the application container.
+// The existence of the preset is checked by the operator, the presets are configured there.
+func validateResources(resources *ResourcesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if resources.Preset != "" {
+		for _, msg := range validation.IsDNS1123Label(resources.Preset) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("preset"), resources.Preset, msg))
+		}
+	}
+	allErrs = append(allErrs, validateResourceList(resources.Requests, fldPath.Child("requests"))...)
+	allErrs = append(allErrs, validateResourceList(resources.Limits, fldPath.Child("limits"))...)
+	for _, name := range sortedResourceNames(resources.Requests) {
+		request := resources.Requests[name]
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("requests").Key(string(name)), request.String(),
+				fmt.Sprintf("must be less than or equal to %s limit of %s", name, limit.String())))
+		}
+	}
+	return allErrs
+}
+
+// validateResourceList validates that only cpu, memory and ephemeral-storage are set with non-negative quantities
+func validateResourceList(list corev1.ResourceList, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, name := range sortedResourceNames(list) {
+		quantity := list[name]
+		switch name {
+		case corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+		default:
+			allErrs = append(allErrs, field.NotSupported(fldPath.Key(string(name)), name,
+				[]string{string(corev1.ResourceCPU), string(corev1.ResourceMemory), string(corev1.ResourceEphemeralStorage)}))
+			continue
+		}
+		if quantity.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(string(name)), quantity.String(), "must be greater than or equal to 0"))
+		}
+	}
+	return allErrs
+}
+
+// sortedResourceNames returns the resource names of list in order, so the errors are reported in a stable order
+func sortedResourceNames(list corev1.ResourceList) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// validateProbes validates the health path and the probes of the application container
+func validateProbes(probes *ProbesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if probes.HealthPath != "" {
+		allErrs = append(allErrs, validateProbePath(probes.HealthPath, fldPath.Child("healthPath"))...)
+	}
+	if probes.Liveness != nil {
+		allErrs = append(allErrs, validateProbe(probes.Liveness, fldPath.Child("liveness"))...)
+		// Kubernetes accepts only 1 for the liveness and startup probes
+		if probes.Liveness.SuccessThreshold > 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("liveness", "successThreshold"), probes.Liveness.SuccessThreshold, "must be 1"))
+		}
+	}
+	if probes.Readiness != nil {
+		allErrs = append(allErrs, validateProbe(probes.Readiness, fldPath.Child("readiness"))...)
+	}
+	if probes.Startup != nil {
+		allErrs = append(allErrs, validateProbe(probes.Startup, fldPath.Child("startup"))...)
+		if probes.Startup.SuccessThreshold > 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("startup", "successThreshold"), probes.Startup.SuccessThreshold, "must be 1"))
+		}
+	}
+	return allErrs
+}
+
+// validateProbe validates that exactly one complete check is set
+func validateProbe(probe *Probe, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	checks := 0
+	if probe.HTTPGet != nil {
+		checks++
+		if probe.HTTPGet.Path != "" {
+			allErrs = append(allErrs, validateProbePath(probe.HTTPGet.Path, fldPath.Child("httpGet", "path"))...)
+		}
+		allErrs = append(allErrs, validateProbePort(probe.HTTPGet.Port, fldPath.Child("httpGet", "port"))...)
+	}
+	if probe.TCPSocket != nil {
+		checks++
+		allErrs = append(allErrs, validateProbePort(probe.TCPSocket.Port, fldPath.Child("tcpSocket", "port"))...)
+	}
+	if probe.Exec != nil {
+		checks++
+		if len(probe.Exec.Command) == 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Child("exec", "command"), "command of the check is required"))
+		}
+	}
+	if checks != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", "must specify exactly one of: `httpGet`, `tcpSocket` or `exec`"))
+	}
+	return allErrs
+}
+
+// validateProbePath validates the path of an HTTP check
+func validateProbePath(path string, fldPath *field.Path) field.ErrorList {
+	if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, " \t\n") {
+		return field.ErrorList{field.Invalid(fldPath, path, "must be an absolute path without whitespace")}
+	}
+	return nil
+}
+
+// validateProbePort validates the port of a check, 0 means the port of the application
+func validateProbePort(port int32, fldPath *field.Path) field.ErrorList {
+	if port < 0 || port > 65535 {
+		return field.ErrorList{field.Invalid(fldPath, port, validation.InclusiveRangeError(0, 65535))}
+	}
+	return nil
+}
+
+// validateImage validates the image repository and its tag
+func validateImage(image, tag string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if image == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("image"), "image of the application is required"))
+	} else if !imageRegexp.MatchString(image) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("image"), image,
+			"must be an image repository reference (e.g. 'gcr.io/kuar-demo/kuard-amd64'), the tag is set in 'tag'"))
+	}
+	if tag == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("tag"), "tag of the image is required"))
+	} else if !imageTagRegexp.MatchString(tag) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("tag"), tag,
+			"must consist of alphanumeric characters, '_', '.' or '-', must not start with '.' or '-' and must be at most 128 characters"))
+	}
+	return allErrs
+}
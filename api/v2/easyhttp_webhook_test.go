@@ -0,0 +1,437 @@
+package v2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newValidEasyHttp() *EasyHttp {
+	var replicas int32 = 2
+	r := &EasyHttp{}
+	r.Name = "app1"
+	r.Namespace = "namespace1"
+	r.Spec = EasyHttpSpec{
+		Host: "app.example.com",
+		Container: ContainerSpec{
+			Image: "gcr.io/kuar-demo/kuard-amd64",
+			Tag:   "1",
+			Port:  8080,
+			Env:   []EnvVar{{Name: "PORT", Value: "8080"}},
+		},
+		Routes:  []RouteSpec{{Path: "/app"}},
+		TLS:     TLSSpec{Issuer: "letsencrypt-staging"},
+		Scaling: ScalingSpec{Replicas: &replicas},
+	}
+	return r
+}
+
+func TestValidateCreate(t *testing.T) {
+	var negative int32 = -1
+
+	tests := map[string]struct {
+		modify func(r *EasyHttp)
+		fields []string
+	}{
+		"valid":                {modify: func(r *EasyHttp) {}},
+		"wildcard host":        {modify: func(r *EasyHttp) { r.Spec.Host = "*.example.com"; r.Spec.TLS.Issuer = "" }},
+		"wildcard host, tls":   {modify: func(r *EasyHttp) { r.Spec.Host = "*.example.com" }, fields: []string{"spec.host"}},
+		"root path":            {modify: func(r *EasyHttp) { r.Spec.Routes[0].Path = "/" }},
+		"no routes":            {modify: func(r *EasyHttp) { r.Spec.Routes = nil }},
+		"nested path":          {modify: func(r *EasyHttp) { r.Spec.Routes[0].Path = "/api/v1-beta" }},
+		"registry with port":   {modify: func(r *EasyHttp) { r.Spec.Container.Image = "localhost:5000/team/app" }},
+		"cert manager off":     {modify: func(r *EasyHttp) { r.Spec.TLS.Issuer = "" }},
+		"missing host":         {modify: func(r *EasyHttp) { r.Spec.Host = "" }, fields: []string{"spec.host"}},
+		"host is not DNS name": {modify: func(r *EasyHttp) { r.Spec.Host = "https://Example.com" }, fields: []string{"spec.host"}},
+		"regex in path":        {modify: func(r *EasyHttp) { r.Spec.Routes[0].Path = "/app.*" }, fields: []string{"spec.routes[0].path"}},
+		"relative path":        {modify: func(r *EasyHttp) { r.Spec.Routes[0].Path = "app" }, fields: []string{"spec.routes[0].path"}},
+		"trailing slash":       {modify: func(r *EasyHttp) { r.Spec.Routes[0].Path = "/app/" }, fields: []string{"spec.routes[0].path"}},
+		"port 0":               {modify: func(r *EasyHttp) { r.Spec.Container.Port = 0 }, fields: []string{"spec.container.port"}},
+		"port too big":         {modify: func(r *EasyHttp) { r.Spec.Container.Port = 70000 }, fields: []string{"spec.container.port"}},
+		"missing image":        {modify: func(r *EasyHttp) { r.Spec.Container.Image = "" }, fields: []string{"spec.container.image"}},
+		"image with tag":       {modify: func(r *EasyHttp) { r.Spec.Container.Image = "nginx:1.23" }, fields: []string{"spec.container.image"}},
+		"uppercase image":      {modify: func(r *EasyHttp) { r.Spec.Container.Image = "Nginx" }, fields: []string{"spec.container.image"}},
+		"missing tag":          {modify: func(r *EasyHttp) { r.Spec.Container.Tag = "" }, fields: []string{"spec.container.tag"}},
+		"invalid tag":          {modify: func(r *EasyHttp) { r.Spec.Container.Tag = "-1.0" }, fields: []string{"spec.container.tag"}},
+		"negative replicas":    {modify: func(r *EasyHttp) { r.Spec.Scaling.Replicas = &negative }, fields: []string{"spec.scaling.replicas"}},
+		"invalid issuer":       {modify: func(r *EasyHttp) { r.Spec.TLS.Issuer = "Let's Encrypt" }, fields: []string{"spec.tls.issuer"}},
+		"invalid env names": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Container.Env = []EnvVar{{Name: "1ST", Value: "a"}, {Name: "OK", Value: "b"}, {Name: "MY=VAR", Value: "c"}}
+			},
+			fields: []string{"spec.container.env[0].name", "spec.container.env[2].name"},
+		},
+		"duplicated env name": {
+			modify: func(r *EasyHttp) { r.Spec.Container.Env = []EnvVar{{Name: "A", Value: "a"}, {Name: "A", Value: "b"}} },
+			fields: []string{"spec.container.env[1].name"},
+		},
+		"env value sources": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Container.Env = []EnvVar{
+					{Name: "PASSWORD", ValueFrom: &EnvVarSource{SecretKeyRef: secretKeyRef("db", "password")}},
+					{Name: "MODE", ValueFrom: &EnvVarSource{ConfigMapKeyRef: configMapKeyRef("app", "mode")}},
+					{Name: "POD_IP", ValueFrom: &EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"}}},
+				}
+				r.Spec.Container.EnvFrom = []corev1.EnvFromSource{
+					{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}},
+					{Prefix: "DB_", SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}}},
+				}
+			},
+		},
+		"value and value source": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Container.Env = []EnvVar{{Name: "A", Value: "a", ValueFrom: &EnvVarSource{SecretKeyRef: secretKeyRef("db", "a")}}}
+			},
+			fields: []string{"spec.container.env[0].valueFrom"},
+		},
+		"invalid value sources": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Container.Env = []EnvVar{
+					{Name: "A", ValueFrom: &EnvVarSource{}},
+					{Name: "B", ValueFrom: &EnvVarSource{SecretKeyRef: secretKeyRef("db", ""), ConfigMapKeyRef: configMapKeyRef("", "b")}},
+					{Name: "C", ValueFrom: &EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{}}},
+				}
+			},
+			fields: []string{"spec.container.env[0].valueFrom", "spec.container.env[1].valueFrom.secretKeyRef.key",
+				"spec.container.env[1].valueFrom.configMapKeyRef.name", "spec.container.env[1].valueFrom",
+				"spec.container.env[2].valueFrom.fieldRef.fieldPath"},
+		},
+		"invalid env from sources": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Container.EnvFrom = []corev1.EnvFromSource{
+					{},
+					{Prefix: "1-", SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "Db"}}},
+				}
+			},
+			fields: []string{"spec.container.envFrom[0]", "spec.container.envFrom[1].prefix", "spec.container.envFrom[1].secretRef.name"},
+		},
+		"probes": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Probes = ProbesSpec{
+					HealthPath: "/healthz",
+					Liveness:   &Probe{TCPSocket: &TCPSocketProbe{}, PeriodSeconds: 30},
+					Readiness:  &Probe{HTTPGet: &HTTPGetProbe{Path: "/ready?full=1", Port: 9090}, SuccessThreshold: 2},
+					Startup:    &Probe{Exec: &ExecProbe{Command: []string{"cat", "/tmp/started"}}, FailureThreshold: 30},
+				}
+			},
+		},
+		"invalid probes": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Probes = ProbesSpec{
+					HealthPath: "healthz",
+					Liveness:   &Probe{HTTPGet: &HTTPGetProbe{Port: 70000}, SuccessThreshold: 2},
+					Readiness:  &Probe{HTTPGet: &HTTPGetProbe{}, TCPSocket: &TCPSocketProbe{}},
+					Startup:    &Probe{Exec: &ExecProbe{}},
+				}
+			},
+			fields: []string{"spec.probes.healthPath", "spec.probes.liveness.httpGet.port", "spec.probes.liveness.successThreshold",
+				"spec.probes.readiness", "spec.probes.startup.exec.command"},
+		},
+		"autoscaling": {
+			modify: func(r *EasyHttp) {
+				var minReplicas, cpu int32 = 2, 70
+				r.Spec.Scaling.Autoscaling = &AutoscalingSpec{
+					MinReplicas: &minReplicas, MaxReplicas: 10, TargetCPUUtilizationPercentage: &cpu,
+					Metrics: []autoscalingv2.MetricSpec{{Type: autoscalingv2.ExternalMetricSourceType, External: &autoscalingv2.ExternalMetricSource{}}},
+				}
+			},
+		},
+		"invalid autoscaling": {
+			modify: func(r *EasyHttp) {
+				var minReplicas, cpu int32 = 3, 0
+				r.Spec.Scaling.Autoscaling = &AutoscalingSpec{
+					MinReplicas: &minReplicas, MaxReplicas: 2, TargetCPUUtilizationPercentage: &cpu,
+					Metrics: []autoscalingv2.MetricSpec{{Type: autoscalingv2.PodsMetricSourceType}, {Type: "Custom"}},
+				}
+			},
+			fields: []string{"spec.scaling.autoscaling.minReplicas", "spec.scaling.autoscaling.targetCPUUtilizationPercentage",
+				"spec.scaling.autoscaling.metrics[0]", "spec.scaling.autoscaling.metrics[1].type"},
+		},
+		"rolling update": {
+			modify: func(r *EasyHttp) {
+				maxSurge, maxUnavailable := intstr.FromString("50%"), intstr.FromInt(0)
+				r.Spec.Strategy = StrategySpec{Type: "RollingUpdate", MaxSurge: &maxSurge, MaxUnavailable: &maxUnavailable, MinReadySeconds: 10}
+			},
+		},
+		"recreate with rolling update parameters": {
+			modify: func(r *EasyHttp) {
+				maxSurge := intstr.FromInt(1)
+				r.Spec.Strategy = StrategySpec{Type: "Recreate", MaxSurge: &maxSurge}
+			},
+			fields: []string{"spec.strategy.maxSurge"},
+		},
+		"rolling update without progress": {
+			modify: func(r *EasyHttp) {
+				maxSurge, maxUnavailable := intstr.FromString("0%"), intstr.FromInt(0)
+				r.Spec.Strategy = StrategySpec{MaxSurge: &maxSurge, MaxUnavailable: &maxUnavailable}
+			},
+			fields: []string{"spec.strategy.maxUnavailable"},
+		},
+		"canary": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Canary = &CanarySpec{Tag: "2.0", Weight: 10, Header: "X-Canary", HeaderValue: "always", Cookie: "canary"}
+			},
+		},
+		"invalid canary": {
+			modify: func(r *EasyHttp) {
+				replicas := int32(-1)
+				r.Spec.Canary = &CanarySpec{Replicas: &replicas, Weight: 101, HeaderValue: "always", Cookie: "can ary"}
+			},
+			fields: []string{"spec.canary.tag", "spec.canary.replicas", "spec.canary.weight", "spec.canary.headerValue", "spec.canary.cookie"},
+		},
+		"blue/green": {
+			modify: func(r *EasyHttp) {
+				replicas := int32(3)
+				r.Spec.Strategy = StrategySpec{Type: StrategyBlueGreen}
+				r.Spec.Scaling.Replicas = &replicas
+			},
+		},
+		"blue/green with canary, autoscaling and disruption budget": {
+			modify: func(r *EasyHttp) {
+				maxUnavailable := intstr.FromInt(1)
+				r.Spec.Strategy = StrategySpec{Type: StrategyBlueGreen}
+				r.Spec.Canary = &CanarySpec{Tag: "2.0", Weight: 10}
+				r.Spec.Scaling.Autoscaling = &AutoscalingSpec{MaxReplicas: 3}
+				r.Spec.DisruptionBudget = &DisruptionBudgetSpec{MaxUnavailable: &maxUnavailable}
+			},
+			fields: []string{"spec.canary", "spec.scaling.autoscaling", "spec.disruptionBudget"},
+		},
+		"aliases": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Aliases = []string{"www.example.net", "*.example.org"}
+				r.Spec.RedirectAliases = true
+				r.Spec.TLS.Issuer = ""
+			},
+		},
+		"wildcard alias, tls": {
+			modify: func(r *EasyHttp) { r.Spec.Aliases = []string{"www.example.net", "*.example.org"} },
+			fields: []string{"spec.aliases[1]"},
+		},
+		"invalid aliases": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Aliases = []string{r.Spec.Host, "", "Example.org", "a.example.org", "a.example.org"}
+			},
+			fields: []string{"spec.aliases[0]", "spec.aliases[1]", "spec.aliases[2]", "spec.aliases[4]"},
+		},
+		"redirect without aliases": {
+			modify: func(r *EasyHttp) {
+				r.Spec.RedirectAliases = true
+			},
+			fields: []string{"spec.redirectAliases"},
+		},
+		"routes": {
+			modify: func(r *EasyHttp) {
+				exact, rewrite := netv1.PathTypeExact, false
+				r.Spec.Routes = []RouteSpec{{Path: "/api"}, {Path: "/admin", PathType: &exact, Port: 9090, Rewrite: &rewrite}}
+			},
+		},
+		"invalid routes": {
+			modify: func(r *EasyHttp) {
+				exact, rewrite := netv1.PathTypeExact, true
+				r.Spec.Routes = []RouteSpec{{Path: "/api"}, {Path: "/api", Port: 70000}, {Path: "/admin", PathType: &exact, Rewrite: &rewrite}}
+			},
+			fields: []string{"spec.routes[1].path", "spec.routes[1].port", "spec.routes[2].rewrite"},
+		},
+		"service port": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Container.ServicePort = 80
+				r.Spec.Routes = []RouteSpec{{Path: "/api", Port: r.Spec.Container.Port}, {Path: "/admin", Port: 9090}}
+			},
+		},
+		"invalid service port": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Container.ServicePort = 9090
+				r.Spec.Routes = []RouteSpec{{Path: "/admin", Port: 9090}}
+			},
+			fields: []string{"spec.routes[0].port"},
+		},
+		"service port out of range": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Container.ServicePort = 70000
+			},
+			fields: []string{"spec.container.servicePort"},
+		},
+		"traefik ingress provider": {
+			modify: func(r *EasyHttp) {
+				r.Spec.IngressProvider = IngressProviderTraefik
+				r.Spec.Routes = []RouteSpec{{Path: "/api"}, {Path: "/admin"}}
+			},
+		},
+		"unknown ingress provider": {
+			modify: func(r *EasyHttp) {
+				r.Spec.IngressProvider = "istio"
+			},
+			fields: []string{"spec.ingressProvider"},
+		},
+		"features of nginx without rewrite": {
+			modify: func(r *EasyHttp) {
+				rewrite := true
+				r.Spec.IngressProvider = IngressProviderNone
+				r.Spec.Aliases = []string{"www.example.net"}
+				r.Spec.RedirectAliases = true
+				r.Spec.Canary = &CanarySpec{Tag: "2.0", Weight: 10}
+				r.Spec.Routes = []RouteSpec{{Path: "/api", Rewrite: &rewrite}}
+			},
+			fields: []string{"spec.canary", "spec.redirectAliases", "spec.routes[0].rewrite"},
+		},
+		"revision history limit": {
+			modify: func(r *EasyHttp) {
+				limit := int32(0)
+				r.Spec.RevisionHistoryLimit = &limit
+			},
+			fields: []string{"spec.revisionHistoryLimit"},
+		},
+		"disruption budget": {
+			modify: func(r *EasyHttp) {
+				maxUnavailable := intstr.FromString("25%")
+				r.Spec.DisruptionBudget = &DisruptionBudgetSpec{MaxUnavailable: &maxUnavailable}
+			},
+		},
+		"invalid disruption budget": {
+			modify: func(r *EasyHttp) {
+				minAvailable, maxUnavailable := intstr.FromInt(-1), intstr.FromString("120%")
+				r.Spec.DisruptionBudget = &DisruptionBudgetSpec{MinAvailable: &minAvailable, MaxUnavailable: &maxUnavailable}
+			},
+			fields: []string{"spec.disruptionBudget", "spec.disruptionBudget.minAvailable", "spec.disruptionBudget.maxUnavailable"},
+		},
+		"disruption budget is not a percentage": {
+			modify: func(r *EasyHttp) {
+				minAvailable := intstr.FromString("half")
+				r.Spec.DisruptionBudget = &DisruptionBudgetSpec{MinAvailable: &minAvailable}
+			},
+			fields: []string{"spec.disruptionBudget.minAvailable"},
+		},
+		"resources": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Resources = ResourcesSpec{
+					Preset:   "small",
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi"), corev1.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+				}
+			},
+		},
+		"invalid resources": {
+			modify: func(r *EasyHttp) {
+				r.Spec.Resources = ResourcesSpec{
+					Preset:   "Small",
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi"), "nvidia.com/gpu": resource.MustParse("1")},
+					Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("-1"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+				}
+			},
+			fields: []string{"spec.resources.preset", "spec.resources.requests[nvidia.com/gpu]", "spec.resources.limits[cpu]",
+				"spec.resources.requests[memory]"},
+		},
+		"multiple errors": {
+			modify: func(r *EasyHttp) { r.Spec.Host = ""; r.Spec.Container.Port = -1 },
+			fields: []string{"spec.host", "spec.container.port"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := newValidEasyHttp()
+			test.modify(r)
+			err := r.ValidateCreate()
+			assertInvalidFields(t, err, test.fields)
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	old := newValidEasyHttp()
+
+	r := newValidEasyHttp()
+	r.Spec.Container.Tag = "2"
+	r.Spec.Routes[0].Path = "/other"
+	assert.NoError(t, r.ValidateUpdate(old))
+
+	// the host can be changed only to one of the previous aliases
+	r.Spec.Host = "other.example.com"
+	r.Spec.Aliases = []string{"app.example.com"}
+	assertInvalidFields(t, r.ValidateUpdate(old), []string{"spec.host"})
+
+	old.Spec.Aliases = []string{"other.example.com"}
+	assert.NoError(t, r.ValidateUpdate(old))
+
+	r.Spec.Container.Port = 0
+	assertInvalidFields(t, r.ValidateUpdate(old), []string{"spec.container.port"})
+}
+
+func secretKeyRef(name, key string) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+}
+
+func configMapKeyRef(name, key string) *corev1.ConfigMapKeySelector {
+	return &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+}
+
+// assertInvalidFields checks if err is an Invalid error of the given fields (no error when fields is empty)
+func assertInvalidFields(t *testing.T, err error, fields []string) {
+	if len(fields) == 0 {
+		assert.NoError(t, err)
+		return
+	}
+	assert.True(t, apierrors.IsInvalid(err), "expected invalid error, got %v", err)
+	statusErr, ok := err.(*apierrors.StatusError)
+	if !assert.True(t, ok) {
+		return
+	}
+	var got []string
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		got = append(got, cause.Field)
+	}
+	assert.Equal(t, fields, got)
+}
+
+func TestDefault(t *testing.T) {
+	defaulter := &EasyHttpDefaulter{IngressClassName: "nginx", CertManIssuer: "letsencrypt-prod", IngressProvider: IngressProviderNginx}
+
+	// empty fields are defaulted
+	r := &EasyHttp{}
+	r.Spec.Host = "app.example.com"
+	r.Spec.Container.Image = "nginx"
+	assert.NoError(t, defaulter.Default(context.Background(), r))
+	assert.Equal(t, DefaultReplicas, *r.Spec.Scaling.Replicas)
+	assert.Equal(t, DefaultImageTag, r.Spec.Container.Tag)
+	assert.Equal(t, []RouteSpec{{Path: DefaultPath}}, r.Spec.Routes)
+	assert.Equal(t, DefaultPort, r.Spec.Container.Port)
+	assert.Equal(t, "nginx", r.Spec.IngressClassName)
+	assert.Equal(t, "letsencrypt-prod", r.Spec.TLS.Issuer)
+	assert.Equal(t, IngressProviderNginx, r.Spec.IngressProvider)
+	assert.NoError(t, r.ValidateCreate())
+
+	// set fields are kept
+	r = newValidEasyHttp()
+	r.Spec.IngressClassName = "traefik"
+	r.Spec.IngressProvider = IngressProviderTraefik
+	expected := r.Spec.DeepCopy()
+	assert.NoError(t, defaulter.Default(context.Background(), r))
+	assert.Equal(t, expected, &r.Spec)
+
+	// the cluster specific defaults are not set again on update, so TLS can be turned off
+	r = newValidEasyHttp()
+	r.Spec.TLS.Issuer = ""
+	update := admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update}})
+	assert.NoError(t, defaulter.Default(update, r))
+	assert.Empty(t, r.Spec.TLS.Issuer)
+	assert.Empty(t, r.Spec.IngressClassName)
+	create := admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create}})
+	assert.NoError(t, defaulter.Default(create, r))
+	assert.Equal(t, "letsencrypt-prod", r.Spec.TLS.Issuer)
+
+	// no cluster specific defaults in the operator configuration
+	r = &EasyHttp{}
+	assert.NoError(t, (&EasyHttpDefaulter{}).Default(context.Background(), r))
+	assert.Empty(t, r.Spec.IngressClassName)
+	assert.Empty(t, r.Spec.TLS.Issuer)
+	assert.Empty(t, r.Spec.IngressProvider)
+}
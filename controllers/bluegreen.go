@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// otherColor returns the color of the blue/green deployment which is not color
+func otherColor(color string) string {
+	if color == httpapiv2.ColorBlue {
+		return httpapiv2.ColorGreen
+	}
+	return httpapiv2.ColorBlue
+}
+
+// colorResource returns the EasyHttp the resources of the color deployment are built from: the application with the
+// name of the color and the given spec. The replicas are always the current ones, so scaling does not need a promotion.
+func colorResource(clientResource *httpapiv2.EasyHttp, color string, spec *httpapiv2.EasyHttpSpec) *httpapiv2.EasyHttp {
+	colored := clientResource.DeepCopy()
+	colored.Name = clientResource.Name + "-" + color
+	colored.Spec = *spec.DeepCopy()
+	colored.Spec.Scaling = *clientResource.Spec.Scaling.DeepCopy()
+	// the color deployment itself is updated in place (scaling, referenced configuration) by the default strategy
+	colored.Spec.Strategy.Type = ""
+	return colored
+}
+
+// initColorDeployment creates the deployment of the color based on clientResource running spec
+func initColorDeployment(clientResource *httpapiv2.EasyHttp, color string, spec *httpapiv2.EasyHttpSpec, params deploymentParams) *appsv1.Deployment {
+	return initDeployment(colorResource(clientResource, color, spec), params)
+}
+
+// initColorService creates the service of the color based on clientResource running spec. Its ports are the ports of
+// spec, the ingress is built from the same spec while the color is active (see routedResource).
+func initColorService(clientResource *httpapiv2.EasyHttp, color string, spec *httpapiv2.EasyHttpSpec) *corev1.Service {
+	return initService(colorResource(clientResource, color, spec))
+}
+
+// routedResource returns the EasyHttp the ingress is built from: the application with the active spec when the BlueGreen
+// strategy is used, so the routes of a new spec are switched together with its pods when the preview is promoted
+func routedResource(clientResource *httpapiv2.EasyHttp) *httpapiv2.EasyHttp {
+	bg := clientResource.Status.BlueGreen
+	if clientResource.Spec.Strategy.Type != httpapiv2.StrategyBlueGreen || bg == nil || bg.ActiveSpec == nil {
+		return clientResource
+	}
+	routed := clientResource.DeepCopy()
+	routed.Spec = *bg.ActiveSpec.DeepCopy()
+	return routed
+}
+
+// previewRequired returns true if the pods of the current spec of clientResource differ from the pods of the active spec
+func previewRequired(clientResource *httpapiv2.EasyHttp, params deploymentParams) bool {
+	bg := clientResource.Status.BlueGreen
+	active := initColorDeployment(clientResource, bg.ActiveColor, bg.ActiveSpec, params)
+	current := initColorDeployment(clientResource, bg.ActiveColor, &clientResource.Spec, params)
+	return !equality.Semantic.DeepEqual(active.Spec, current.Spec)
+}
+
+// CheckBlueGreen applies the deployment and the service of the active color and, when the spec has changed since the
+// active one has been rolled out, the deployment and the service of the preview color. The preview becomes active when
+// it is ready and its promotion has been requested. Returns the service of the active color and true if the colors
+// have been switched.
+func (r *EasyHttpReconciler) CheckBlueGreen(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv2.EasyHttp) (ctrl.Result, *corev1.Service, bool, error) {
+	log := log.FromContext(ctx)
+
+	params, err := r.deploymentParams(ctx, clientResource)
+	if err != nil {
+		r.reconcileFailed(clientResource, httpapiv2.ConditionDeploymentReady, err)
+		return ctrl.Result{Requeue: true}, nil, false, err
+	}
+
+	// the current spec becomes active when the strategy is switched to BlueGreen
+	if clientResource.Status.BlueGreen == nil {
+		clientResource.Status.BlueGreen = &httpapiv2.BlueGreenStatus{ActiveColor: httpapiv2.ColorBlue, ActiveSpec: clientResource.Spec.DeepCopy()}
+	}
+	bg := clientResource.Status.BlueGreen
+	switched := false
+	result := ctrl.Result{}
+
+	previewColor := otherColor(bg.ActiveColor)
+	if previewRequired(clientResource, params) {
+		newDep := initColorDeployment(clientResource, previewColor, &clientResource.Spec, params)
+		dep := &appsv1.Deployment{}
+		applied, err := r.ensure(ctx, req, newDep, dep, func() bool { return deploymentInSync(newDep, dep) }, clientResource,
+			httpapiv2.ConditionPreviewReady, specHasChanged)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, nil, false, fmt.Errorf("failed to apply preview deployment. %v", err)
+		}
+		if applied {
+			dep = newDep
+		}
+		newSvc := initColorService(clientResource, previewColor, &clientResource.Spec)
+		svc := &corev1.Service{}
+		if _, err = r.ensure(ctx, req, newSvc, svc, func() bool { return serviceInSync(newSvc, svc) }, clientResource,
+			httpapiv2.ConditionPreviewReady, specHasChanged); err != nil {
+			return ctrl.Result{Requeue: true}, nil, false, fmt.Errorf("failed to apply preview service. %v", err)
+		}
+
+		var desired int32 = 1
+		if dep.Spec.Replicas != nil {
+			desired = *dep.Spec.Replicas
+		}
+		ready, reason, message := rolloutProgress(dep, desired)
+		switch {
+		case ready && bg.PromotionRequested:
+			bg.ActiveColor, bg.ActiveSpec, bg.PromotionRequested = previewColor, clientResource.Spec.DeepCopy(), false
+			switched = true
+			message = fmt.Sprintf("Preview %s has been promoted, the ingress is switched to it", dep.Name)
+			log.Info(message)
+			r.Recorder.Event(clientResource, corev1.EventTypeNormal, httpapiv2.ReasonPreviewPromoted, message)
+			setCondition(clientResource, httpapiv2.ConditionPreviewReady, metav1.ConditionTrue, httpapiv2.ReasonPreviewPromoted, message)
+		case ready:
+			setCondition(clientResource, httpapiv2.ConditionPreviewReady, metav1.ConditionTrue, httpapiv2.ReasonPromotionPending,
+				fmt.Sprintf("%s, waiting for the promotion of preview %s", message, dep.Name))
+		default:
+			setCondition(clientResource, httpapiv2.ConditionPreviewReady, metav1.ConditionFalse, reason, message)
+			if reason == httpapiv2.ReasonRolloutInProgress {
+				result = ctrl.Result{RequeueAfter: rolloutRequeueDelay}
+			}
+		}
+	} else {
+		// the spec does not change the pods (e.g. new host), there is nothing to promote
+		bg.ActiveSpec, bg.PromotionRequested = clientResource.Spec.DeepCopy(), false
+		if err = r.removeColor(ctx, clientResource, previewColor, httpapiv2.ConditionPreviewReady); err != nil {
+			return ctrl.Result{Requeue: true}, nil, false, err
+		}
+		setCondition(clientResource, httpapiv2.ConditionPreviewReady, metav1.ConditionTrue, httpapiv2.ReasonNoPreview, "There is no preview")
+	}
+
+	newDep := initColorDeployment(clientResource, bg.ActiveColor, bg.ActiveSpec, params)
+	dep := &appsv1.Deployment{}
+	applied, err := r.ensure(ctx, req, newDep, dep, func() bool { return deploymentInSync(newDep, dep) }, clientResource,
+		httpapiv2.ConditionDeploymentReady, specHasChanged)
+	if err != nil {
+		return ctrl.Result{Requeue: true}, nil, false, fmt.Errorf("failed to apply deployment. %v", err)
+	}
+	if applied {
+		dep = newDep
+	}
+	newSvc := initColorService(clientResource, bg.ActiveColor, bg.ActiveSpec)
+	svc := &corev1.Service{}
+	applied, err = r.ensure(ctx, req, newSvc, svc, func() bool { return serviceInSync(newSvc, svc) }, clientResource,
+		httpapiv2.ConditionServiceReady, specHasChanged)
+	if err != nil {
+		return ctrl.Result{Requeue: true}, nil, false, fmt.Errorf("failed to apply service. %v", err)
+	}
+	if applied {
+		svc = newSvc
+	} else {
+		markInSync(clientResource, httpapiv2.ConditionServiceReady, svc.Name)
+	}
+	log.Info(fmt.Sprintf("Current active Deployment is: %v (%v)", dep.Name, dep.UID))
+
+	return earliestResult(result, updateRolloutStatus(clientResource, dep)), svc, switched, nil
+}
+
+// CheckStrategyCleanup deletes the resources of the strategy which is not used anymore, once the deployment of the
+// current one is ready: the deployment and the service of the application with the BlueGreen strategy and the color
+// deployments and services with the other strategies
+func (r *EasyHttpReconciler) CheckStrategyCleanup(ctx context.Context, clientResource *httpapiv2.EasyHttp) error {
+	if !isConditionTrue(clientResource, httpapiv2.ConditionDeploymentReady) {
+		return nil
+	}
+	condType := httpapiv2.ConditionDeploymentReady
+	if clientResource.Spec.Strategy.Type == httpapiv2.StrategyBlueGreen {
+		if err := r.removeOwned(ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: clientResource.Name + "-svc"}},
+			"Service", clientResource, condType); err != nil {
+			return err
+		}
+		return r.removeOwned(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: clientResource.Name}},
+			"Deployment", clientResource, condType)
+	}
+	if clientResource.Status.BlueGreen == nil {
+		return nil
+	}
+	for _, color := range []string{httpapiv2.ColorBlue, httpapiv2.ColorGreen} {
+		if err := r.removeColor(ctx, clientResource, color, condType); err != nil {
+			return err
+		}
+	}
+	clientResource.Status.BlueGreen = nil
+	return nil
+}
+
+// removeColor deletes the deployment and the service of the color created by the operator
+func (r *EasyHttpReconciler) removeColor(ctx context.Context, clientResource *httpapiv2.EasyHttp, color, condType string) error {
+	name := clientResource.Name + "-" + color
+	stale := []struct {
+		kind string
+		obj  client.Object
+	}{
+		{"Service", &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: name + "-svc"}}},
+		{"Deployment", &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: name}}},
+	}
+	for _, s := range stale {
+		if err := r.removeOwned(ctx, s.obj, s.kind, clientResource, condType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
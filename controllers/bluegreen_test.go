@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	appsv1 "k8s.io/api/apps/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// withBlueGreen switches clientResource to the BlueGreen strategy, the blue color running its previous tag 1.0
+func withBlueGreen(clientResource *httpapiv2.EasyHttp) *httpapiv2.EasyHttp {
+	clientResource.Spec.Strategy.Type = httpapiv2.StrategyBlueGreen
+	activeSpec := clientResource.Spec.DeepCopy()
+	clientResource.Spec.Container.Tag = "2.0"
+	clientResource.Status.BlueGreen = &httpapiv2.BlueGreenStatus{ActiveColor: httpapiv2.ColorBlue, ActiveSpec: activeSpec}
+	return clientResource
+}
+
+// readyDeployment returns dep with a completed rollout
+func readyDeployment(dep *appsv1.Deployment) *appsv1.Deployment {
+	ready := dep.DeepCopy()
+	ready.Status = appsv1.DeploymentStatus{Replicas: *dep.Spec.Replicas, UpdatedReplicas: *dep.Spec.Replicas, AvailableReplicas: *dep.Spec.Replicas}
+	return ready
+}
+
+func TestInitColorResources(t *testing.T) {
+	clientResource := withBlueGreen(newTestResource())
+	activeSpec := clientResource.Status.BlueGreen.ActiveSpec
+	activeSpec.Container.Port = 8080
+
+	dep := initColorDeployment(clientResource, httpapiv2.ColorBlue, activeSpec, deploymentParams{})
+	assert.Equal(t, "app1-blue", dep.Name)
+	assert.Equal(t, int32(2), *dep.Spec.Replicas)
+	assert.Equal(t, appsv1.RollingUpdateDeploymentStrategyType, dep.Spec.Strategy.Type)
+	assert.Equal(t, "testimage:1.0", dep.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, map[string]string{"app": "app1-blue"}, dep.Spec.Selector.MatchLabels)
+
+	svc := initColorService(clientResource, httpapiv2.ColorBlue, activeSpec)
+	assert.Equal(t, "app1-blue-svc", svc.Name)
+	assert.Equal(t, map[string]string{"app": "app1-blue"}, svc.Spec.Selector)
+	assert.Equal(t, int32(8080), svc.Spec.Ports[0].Port)
+	assert.Equal(t, intstr.FromString("http"), svc.Spec.Ports[0].TargetPort)
+}
+
+func TestPreviewRequired(t *testing.T) {
+	clientResource := withBlueGreen(newTestResource())
+	assert.True(t, previewRequired(clientResource, deploymentParams{}))
+
+	// neither the replicas nor the ingress change the pods
+	clientResource.Status.BlueGreen.ActiveSpec.Container.Tag = "2.0"
+	clientResource.Status.BlueGreen.ActiveSpec.Host = "otherhost"
+	var replicas int32 = 1
+	clientResource.Status.BlueGreen.ActiveSpec.Scaling.Replicas = &replicas
+	assert.False(t, previewRequired(clientResource, deploymentParams{}))
+}
+
+// TestCheckBlueGreenPromoteOK positive test for the promotion of a ready preview: the preview becomes active
+func TestCheckBlueGreenPromoteOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := withBlueGreen(newTestResource())
+	clientResource.Status.BlueGreen.PromotionRequested = true
+	previewDep := readyDeployment(initColorDeployment(clientResource, httpapiv2.ColorGreen, &clientResource.Spec, deploymentParams{}))
+	previewSvc := initColorService(clientResource, httpapiv2.ColorGreen, &clientResource.Spec)
+
+	// the preview is read as preview, then as the active color
+	clientMock.On("Get", mock.Anything, client.ObjectKeyFromObject(previewDep), mock.AnythingOfType("*v1.Deployment")).Return(nil).Run(getReturns(previewDep)).Twice()
+	clientMock.On("Get", mock.Anything, client.ObjectKeyFromObject(previewSvc), mock.AnythingOfType("*v1.Service")).Return(nil).Run(getReturns(previewSvc)).Twice()
+	defer clientMock.AssertExpectations(t)
+
+	_, svc, switched, err := reconciler.CheckBlueGreen(ctx, *req, false, clientResource)
+
+	assert.NoError(t, err)
+	assert.True(t, switched)
+	assert.Equal(t, "app1-green-svc", svc.Name)
+	assert.Equal(t, httpapiv2.ColorGreen, clientResource.Status.BlueGreen.ActiveColor)
+	assert.Equal(t, "2.0", clientResource.Status.BlueGreen.ActiveSpec.Container.Tag)
+	assert.False(t, clientResource.Status.BlueGreen.PromotionRequested)
+	assert.True(t, isConditionTrue(clientResource, httpapiv2.ConditionDeploymentReady))
+	assert.Equal(t, "app=app1-green", clientResource.Status.Selector)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionPreviewReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, httpapiv2.ReasonPreviewPromoted, cond.Reason)
+	assertEvent(t, reconciler, httpapiv2.ReasonPreviewPromoted)
+}
+
+// TestCheckBlueGreenNoPreviewOK positive test for the first loop of the BlueGreen strategy: the blue color is created
+func TestCheckBlueGreenNoPreviewOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := withBlueGreen(newTestResource())
+	clientResource.Status.BlueGreen = nil
+
+	notFound := errors.NewNotFound(schema.GroupResource{}, "")
+	// green is removed, blue is created
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Service")).Return(notFound).Twice()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(notFound).Twice()
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*v1.Deployment"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Once()
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*v1.Service"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Once()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Twice()
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Twice()
+	defer subResourceWriterMock.AssertExpectations(t)
+	defer clientMock.AssertExpectations(t)
+
+	res, svc, switched, err := reconciler.CheckBlueGreen(ctx, *req, false, clientResource)
+
+	assert.NoError(t, err)
+	assert.False(t, switched)
+	assert.Equal(t, rolloutRequeueDelay, res.RequeueAfter)
+	assert.Equal(t, "app1-blue-svc", svc.Name)
+	assert.Equal(t, httpapiv2.ColorBlue, clientResource.Status.BlueGreen.ActiveColor)
+	assert.Equal(t, "2.0", clientResource.Status.BlueGreen.ActiveSpec.Container.Tag)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionPreviewReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, httpapiv2.ReasonNoPreview, cond.Reason)
+	assertEvent(t, reconciler, httpapiv2.ReasonCreated)
+}
+
+// TestCheckIngressPreviewOK positive test for a new route on another port during the preview: the ingress and the
+// active service keep the routes and the ports of the active spec until the promotion
+func TestCheckIngressPreviewOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := withBlueGreen(newTestResource())
+	clientResource.Spec.Routes = append(clientResource.Spec.Routes, httpapiv2.RouteSpec{Path: "/metrics", Port: 9090})
+	bg := clientResource.Status.BlueGreen
+	activeSvc := initColorService(clientResource, bg.ActiveColor, bg.ActiveSpec)
+	assert.Len(t, activeSvc.Spec.Ports, 1)
+
+	var applied *netv1.Ingress
+	notFound := errors.NewNotFound(schema.GroupResource{}, "")
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(notFound).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Ingress")).Return(notFound).Times(3)
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*v1.Ingress"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		applied = args.Get(1).(*netv1.Ingress)
+	}).Once()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+	defer subResourceWriterMock.AssertExpectations(t)
+	defer clientMock.AssertExpectations(t)
+
+	_, err := reconciler.CheckIngress(ctx, *req, true, clientResource, activeSvc)
+
+	assert.NoError(t, err)
+	paths := applied.Spec.Rules[0].HTTP.Paths
+	assert.Len(t, paths, 1)
+	assert.Equal(t, "app1-blue-svc", paths[0].Backend.Service.Name)
+	assert.Equal(t, activeSvc.Spec.Ports[0].Port, paths[0].Backend.Service.Port.Number)
+
+	// the promoted spec is routed with its service
+	bg.ActiveColor, bg.ActiveSpec = httpapiv2.ColorGreen, clientResource.Spec.DeepCopy()
+	previewSvc := initColorService(clientResource, bg.ActiveColor, bg.ActiveSpec)
+	ing := initIngress(routedResource(clientResource), previewSvc.Name)
+	assert.Len(t, ing.Spec.Rules[0].HTTP.Paths, 2)
+	assert.Len(t, previewSvc.Spec.Ports, 2)
+}
+
+// TestRunActionPromotePreview positive test for the promote action with the BlueGreen strategy: the promotion is requested in the status
+func TestRunActionPromotePreview(t *testing.T) {
+	reconciler, _ := setup(t)
+	clientResource := withBlueGreen(newTestResource())
+	clientResource.Annotations = map[string]string{httpapiv2.AnnotationAction: httpapiv2.ActionPromote}
+
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
+	subResourceWriterMock.On("Update", mock.Anything, clientResource).Return(nil).Once()
+	clientMock.On("Update", mock.Anything, clientResource).Return(nil).Once()
+	defer subResourceWriterMock.AssertExpectations(t)
+	defer clientMock.AssertExpectations(t)
+
+	_, err := reconciler.runAction(context.Background(), clientResource, httpapiv2.ActionPromote)
+
+	assert.NoError(t, err)
+	assert.NotContains(t, clientResource.Annotations, httpapiv2.AnnotationAction)
+	assert.True(t, clientResource.Status.BlueGreen.PromotionRequested)
+	assert.Equal(t, "2.0", clientResource.Spec.Container.Tag)
+	assertEvent(t, reconciler, httpapiv2.ReasonPromotionPending)
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// canarySuffix is appended to the name of the application in the names of the canary resources
+const canarySuffix = "-canary"
+
+// annotations of the canary ingress of nginx
+const (
+	annotationNginxCanary              = "nginx.ingress.kubernetes.io/canary"
+	annotationNginxCanaryWeight        = "nginx.ingress.kubernetes.io/canary-weight"
+	annotationNginxCanaryByHeader      = "nginx.ingress.kubernetes.io/canary-by-header"
+	annotationNginxCanaryByHeaderValue = "nginx.ingress.kubernetes.io/canary-by-header-value"
+	annotationNginxCanaryByCookie      = "nginx.ingress.kubernetes.io/canary-by-cookie"
+)
+
+// canaryResource returns the EasyHttp the canary resources are built from: the application with the name, image tag
+// and replicas of the canary. Its pods are labeled with its own name, so the service of the application does not select them.
+func canaryResource(clientResource *httpapiv2.EasyHttp) *httpapiv2.EasyHttp {
+	canary := clientResource.DeepCopy()
+	canary.Name = clientResource.Name + canarySuffix
+	canary.Spec.Container.Tag = clientResource.Spec.Canary.Tag
+	replicas := httpapiv2.DefaultReplicas
+	if clientResource.Spec.Canary.Replicas != nil {
+		replicas = *clientResource.Spec.Canary.Replicas
+	}
+	canary.Spec.Scaling = httpapiv2.ScalingSpec{Replicas: &replicas}
+	canary.Spec.Canary = nil
+	canary.Spec.DisruptionBudget = nil
+	return canary
+}
+
+// initCanaryDeployment creates the deployment of the canary based on clientResource
+func initCanaryDeployment(clientResource *httpapiv2.EasyHttp, params deploymentParams) *appsv1.Deployment {
+	return initDeployment(canaryResource(clientResource), params)
+}
+
+// initCanaryService creates the service of the canary based on clientResource
+func initCanaryService(clientResource *httpapiv2.EasyHttp) *corev1.Service {
+	return initService(canaryResource(clientResource))
+}
+
+// initCanaryIngress creates the canary ingress of nginx based on clientResource. It has the same host and path as the
+// ingress of the application and routes the requests selected by the canary spec to the canary service.
+func initCanaryIngress(clientResource *httpapiv2.EasyHttp, serviceName string) *netv1.Ingress {
+	canary := clientResource.Spec.Canary
+	ing := initIngress(canaryResource(clientResource), serviceName)
+
+	// the certificate of the host is requested by the ingress of the application
+	delete(ing.Annotations, annotationCertManEditInPlace)
+	delete(ing.Annotations, annotationCertManIssuer)
+	ing.Spec.TLS = nil
+
+	if ing.Annotations == nil {
+		ing.Annotations = make(map[string]string)
+	}
+	ing.Annotations[annotationNginxCanary] = "true"
+	ing.Annotations[annotationNginxCanaryWeight] = strconv.Itoa(int(canary.Weight))
+	if canary.Header != "" {
+		ing.Annotations[annotationNginxCanaryByHeader] = canary.Header
+		if canary.HeaderValue != "" {
+			ing.Annotations[annotationNginxCanaryByHeaderValue] = canary.HeaderValue
+		}
+	}
+	if canary.Cookie != "" {
+		ing.Annotations[annotationNginxCanaryByCookie] = canary.Cookie
+	}
+	return ing
+}
+
+// CheckCanary applies the deployment, the service and the ingress of the canary when there is a canary and reports the
+// progress of its rollout. The canary resources created by the operator are deleted when there is no canary, after the
+// rollout of the application when the canary has been promoted.
+func (r *EasyHttpReconciler) CheckCanary(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv2.EasyHttp) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	condType := httpapiv2.ConditionCanaryReady
+
+	if clientResource.Spec.Canary == nil {
+		// the promoted canary keeps serving its requests until the application has been rolled out with its tag
+		promoting, err := r.canaryPromoting(ctx, clientResource)
+		if err != nil {
+			r.reconcileFailed(clientResource, condType, err)
+			return ctrl.Result{Requeue: true}, err
+		}
+		if promoting {
+			setCondition(clientResource, condType, metav1.ConditionFalse, httpapiv2.ReasonCanaryPromoted,
+				"Canary is kept until the application has been rolled out with its tag")
+			return ctrl.Result{RequeueAfter: rolloutRequeueDelay}, nil
+		}
+		name := clientResource.Name + canarySuffix
+		stale := []struct {
+			kind string
+			obj  client.Object
+		}{
+			{"Ingress", &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: name + "-ingress"}}},
+			{"Service", &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: name + "-svc"}}},
+			{"Deployment", &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: name}}},
+		}
+		for _, s := range stale {
+			if err := r.removeOwned(ctx, s.obj, s.kind, clientResource, condType); err != nil {
+				return ctrl.Result{Requeue: true}, err
+			}
+		}
+		setCondition(clientResource, condType, metav1.ConditionTrue, httpapiv2.ReasonNoCanary, "There is no canary")
+		return ctrl.Result{}, nil
+	}
+
+	params, err := r.deploymentParams(ctx, clientResource)
+	if err != nil {
+		r.reconcileFailed(clientResource, condType, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	newDep := initCanaryDeployment(clientResource, params)
+	dep := &appsv1.Deployment{}
+	applied, err := r.ensure(ctx, req, newDep, dep, func() bool { return deploymentInSync(newDep, dep) }, clientResource, condType, specHasChanged)
+	if err != nil {
+		return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply canary deployment. %v", err)
+	}
+	if applied {
+		dep = newDep
+	}
+
+	newSvc := initCanaryService(clientResource)
+	svc := &corev1.Service{}
+	if _, err = r.ensure(ctx, req, newSvc, svc, func() bool { return serviceInSync(newSvc, svc) }, clientResource, condType, specHasChanged); err != nil {
+		return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply canary service. %v", err)
+	}
+
+	newIng := initCanaryIngress(clientResource, newSvc.Name)
+	ing := &netv1.Ingress{}
+	if _, err = r.ensure(ctx, req, newIng, ing, func() bool { return ingressInSync(newIng, ing) }, clientResource, condType, specHasChanged); err != nil {
+		return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply canary ingress. %v", err)
+	}
+	log.Info(fmt.Sprintf("Current canary is: %v (%v)", dep.Name, clientResource.Spec.Canary.Tag))
+
+	// the canary is ready when its rollout has been completed
+	var desired int32 = 1
+	if dep.Spec.Replicas != nil {
+		desired = *dep.Spec.Replicas
+	}
+	ready, reason, message := rolloutProgress(dep, desired)
+	if ready {
+		setCondition(clientResource, condType, metav1.ConditionTrue, reason, message)
+		return ctrl.Result{}, nil
+	}
+	setCondition(clientResource, condType, metav1.ConditionFalse, reason, message)
+	if reason != httpapiv2.ReasonRolloutInProgress {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: rolloutRequeueDelay}, nil
+}
+
+// canaryPromoting returns true if the canary deployment of clientResource runs the image of the application (the canary has
+// been promoted) and the rollout of the application deployment has not been completed yet
+func (r *EasyHttpReconciler) canaryPromoting(ctx context.Context, clientResource *httpapiv2.EasyHttp) (bool, error) {
+	if isConditionTrue(clientResource, httpapiv2.ConditionDeploymentReady) {
+		return false, nil
+	}
+	dep := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: clientResource.Namespace, Name: clientResource.Name + canarySuffix}, dep)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("cannot get canary deployment, retying later. %v", err)
+	}
+	if !metav1.IsControlledBy(dep, clientResource) || len(dep.Spec.Template.Spec.Containers) == 0 {
+		return false, nil
+	}
+	image := fmt.Sprintf("%s:%s", clientResource.Spec.Container.Image, clientResource.Spec.Container.Tag)
+	return dep.Spec.Template.Spec.Containers[0].Image == image, nil
+}
+
+// runAction runs the operation requested with the action annotation of clientResource, then removes the annotation.
+// The spec or the status changed by the operation is reconciled in the next loop.
+func (r *EasyHttpReconciler) runAction(ctx context.Context, clientResource *httpapiv2.EasyHttp, action string) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	eventType, reason, message := corev1.EventTypeWarning, httpapiv2.ReasonActionIgnored,
+		fmt.Sprintf("Action %q has been ignored, there is no canary", action)
+	canary := clientResource.Spec.Canary
+	blueGreen := clientResource.Status.BlueGreen
+	switch {
+	case canary == nil && blueGreen != nil && action == httpapiv2.ActionPromote:
+		// the preview is promoted by the reconcile loop when it is ready
+		blueGreen.PromotionRequested = true
+		if err := r.Status().Update(ctx, clientResource); err != nil {
+			return ctrl.Result{}, fmt.Errorf("cannot run action %q. %v", action, err)
+		}
+		eventType, reason, message = corev1.EventTypeNormal, httpapiv2.ReasonPromotionPending,
+			"Promotion of the preview has been requested, it is promoted when it is ready"
+	case canary != nil && action == httpapiv2.ActionPromote:
+		clientResource.Spec.Container.Tag = canary.Tag
+		clientResource.Spec.Canary = nil
+		eventType, reason, message = corev1.EventTypeNormal, httpapiv2.ReasonCanaryPromoted,
+			fmt.Sprintf("Canary has been promoted, the application is updated to tag %s", canary.Tag)
+	case canary != nil && action == httpapiv2.ActionAbort:
+		clientResource.Spec.Canary = nil
+		eventType, reason, message = corev1.EventTypeNormal, httpapiv2.ReasonCanaryAborted,
+			fmt.Sprintf("Canary of tag %s has been aborted", canary.Tag)
+	case canary != nil:
+		message = fmt.Sprintf("Action %q has been ignored, it must be %q or %q", action, httpapiv2.ActionPromote, httpapiv2.ActionAbort)
+	}
+
+	// the status update returns the annotation, it is removed afterwards
+	delete(clientResource.Annotations, httpapiv2.AnnotationAction)
+	if err := r.Update(ctx, clientResource); err != nil {
+		return ctrl.Result{}, fmt.Errorf("cannot run action %q. %v", action, err)
+	}
+	log.Info(message)
+	r.Recorder.Event(clientResource, eventType, reason, message)
+	return ctrl.Result{}, nil
+}
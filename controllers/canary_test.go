@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestInitCanaryResources(t *testing.T) {
+	clientResource := newTestResource()
+	clientResource.Spec.TLS.Issuer = "local.issuer"
+	clientResource.Spec.Canary = &httpapiv2.CanarySpec{Tag: "2.0", Weight: 10, Header: "X-Canary", HeaderValue: "always"}
+
+	dep := initCanaryDeployment(clientResource, deploymentParams{})
+	assert.Equal(t, "app1-canary", dep.Name)
+	assert.Equal(t, int32(1), *dep.Spec.Replicas)
+	assert.Equal(t, "testimage:2.0", dep.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, map[string]string{"app": "app1-canary"}, dep.Spec.Selector.MatchLabels)
+
+	svc := initCanaryService(clientResource)
+	assert.Equal(t, "app1-canary-svc", svc.Name)
+	assert.Equal(t, map[string]string{"app": "app1-canary"}, svc.Spec.Selector)
+
+	ing := initCanaryIngress(clientResource, svc.Name)
+	assert.Equal(t, "app1-canary-ingress", ing.Name)
+	assert.Nil(t, ing.Spec.TLS)
+	assert.Equal(t, "testhost", ing.Spec.Rules[0].Host)
+	assert.Equal(t, "app1-canary-svc", ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name)
+	assert.NotContains(t, ing.Annotations, annotationCertManIssuer)
+	assert.Equal(t, "true", ing.Annotations[annotationNginxCanary])
+	assert.Equal(t, "10", ing.Annotations[annotationNginxCanaryWeight])
+	assert.Equal(t, "X-Canary", ing.Annotations[annotationNginxCanaryByHeader])
+	assert.Equal(t, "always", ing.Annotations[annotationNginxCanaryByHeaderValue])
+	assert.NotContains(t, ing.Annotations, annotationNginxCanaryByCookie)
+
+	// the canary does not change the application
+	assert.Equal(t, "1.0", clientResource.Spec.Container.Tag)
+	assert.Equal(t, int32(2), *clientResource.Spec.Scaling.Replicas)
+}
+
+// TestCanaryNoCanaryOK positive test for an application without canary. Only the canary resources of the operator are deleted
+func TestCanaryNoCanaryOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := newTestResource()
+	clientResource.Spec.Canary = &httpapiv2.CanarySpec{Tag: "2.0", Weight: 10}
+	ownedDep := initCanaryDeployment(clientResource, deploymentParams{})
+	err := ctrl.SetControllerReference(clientResource, ownedDep, reconciler.Scheme)
+	assert.NoError(t, err)
+	clientResource.Spec.Canary = nil
+	setCondition(clientResource, httpapiv2.ConditionDeploymentReady, metav1.ConditionTrue, httpapiv2.ReasonRolloutComplete, "")
+
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Ingress")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Service")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Run(getReturns(ownedDep)).Once()
+	clientMock.On("Delete", mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Once()
+	defer clientMock.AssertExpectations(t)
+
+	_, err = reconciler.CheckCanary(ctx, *req, false, clientResource)
+
+	assert.NoError(t, err)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionCanaryReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, httpapiv2.ReasonNoCanary, cond.Reason)
+	assertEvent(t, reconciler, httpapiv2.ReasonDeleted)
+}
+
+// TestCanaryPromotedOK positive test for a promoted canary: it is kept until the application has been rolled out with its tag
+func TestCanaryPromotedOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := newTestResource()
+	clientResource.Spec.Canary = &httpapiv2.CanarySpec{Tag: "2.0", Weight: 10}
+	ownedDep := initCanaryDeployment(clientResource, deploymentParams{})
+	assert.NoError(t, ctrl.SetControllerReference(clientResource, ownedDep, reconciler.Scheme))
+	clientResource.Spec.Container.Tag = "2.0"
+	clientResource.Spec.Canary = nil
+	setCondition(clientResource, httpapiv2.ConditionDeploymentReady, metav1.ConditionFalse, httpapiv2.ReasonRolloutInProgress, "")
+
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Run(getReturns(ownedDep)).Once()
+	defer clientMock.AssertExpectations(t)
+
+	res, err := reconciler.CheckCanary(ctx, *req, true, clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: rolloutRequeueDelay}, res)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionCanaryReady)
+	assert.Equal(t, httpapiv2.ReasonCanaryPromoted, cond.Reason)
+
+	// the application has been rolled out
+	setCondition(clientResource, httpapiv2.ConditionDeploymentReady, metav1.ConditionTrue, httpapiv2.ReasonRolloutComplete, "")
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Ingress")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Service")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Run(getReturns(ownedDep)).Once()
+	clientMock.On("Delete", mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Once()
+
+	res, err = reconciler.CheckCanary(ctx, *req, false, clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, res)
+	assertEvent(t, reconciler, httpapiv2.ReasonDeleted)
+}
+
+func TestRunAction(t *testing.T) {
+	tests := map[string]struct {
+		action string
+		canary bool
+		tag    string
+		reason string
+	}{
+		"promote":            {action: httpapiv2.ActionPromote, canary: true, tag: "2.0", reason: httpapiv2.ReasonCanaryPromoted},
+		"abort":              {action: httpapiv2.ActionAbort, canary: true, tag: "1.0", reason: httpapiv2.ReasonCanaryAborted},
+		"unknown action":     {action: "rollback", canary: true, tag: "1.0", reason: httpapiv2.ReasonActionIgnored},
+		"promote, no canary": {action: httpapiv2.ActionPromote, tag: "1.0", reason: httpapiv2.ReasonActionIgnored},
+	}
+
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			reconciler, _ := setup(t)
+			clientResource := newTestResource()
+			clientResource.Annotations = map[string]string{httpapiv2.AnnotationAction: v.action}
+			if v.canary {
+				clientResource.Spec.Canary = &httpapiv2.CanarySpec{Tag: "2.0", Weight: 10}
+			}
+
+			clientMock.On("Update", mock.Anything, clientResource).Return(nil).Once()
+			defer clientMock.AssertExpectations(t)
+
+			_, err := reconciler.runAction(context.Background(), clientResource, v.action)
+
+			assert.NoError(t, err)
+			assert.NotContains(t, clientResource.Annotations, httpapiv2.AnnotationAction)
+			assert.Equal(t, v.tag, clientResource.Spec.Container.Tag)
+			assert.Equal(t, v.canary && v.reason == httpapiv2.ReasonActionIgnored, clientResource.Spec.Canary != nil)
+			assertEvent(t, reconciler, v.reason)
+		})
+	}
+}
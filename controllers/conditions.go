@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"fmt"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// resourceConditions are the conditions which are aggregated into the Ready condition
+var resourceConditions = []string{
+	httpapiv2.ConditionDeploymentReady,
+	httpapiv2.ConditionServiceReady,
+	httpapiv2.ConditionIngressReady,
+	httpapiv2.ConditionCertificateReady,
+	httpapiv2.ConditionAutoscalerReady,
+	httpapiv2.ConditionDisruptionBudgetReady,
+	httpapiv2.ConditionCanaryReady,
+	httpapiv2.ConditionPreviewReady,
+}
+
+// setCondition sets (or refreshes) the given condition of clientResource.
+// LastTransitionTime is changed only when the status of the condition changes.
+func setCondition(clientResource *httpapiv2.EasyHttp, condType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&clientResource.Status.Conditions, metav1.Condition{
+		Type:               condType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: clientResource.Generation,
+	})
+}
+
+// isConditionTrue returns true if the given condition of clientResource is true
+func isConditionTrue(clientResource *httpapiv2.EasyHttp, condType string) bool {
+	return meta.IsStatusConditionTrue(clientResource.Status.Conditions, condType)
+}
+
+// markInSync sets the condType condition of clientResource to true when the live object is already the desired one.
+// The reason of an already true condition is kept.
+func markInSync(clientResource *httpapiv2.EasyHttp, condType, name string) {
+	if isConditionTrue(clientResource, condType) {
+		return
+	}
+	setCondition(clientResource, condType, metav1.ConditionTrue, httpapiv2.ReasonInSync, fmt.Sprintf("%s is in sync", name))
+}
+
+// updateReadyCondition aggregates the resource conditions into the Ready condition. The application is not ready when
+// its deployment has been rolled back.
+func updateReadyCondition(clientResource *httpapiv2.EasyHttp) {
+	if cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionRolledBack); cond != nil && cond.Status == metav1.ConditionTrue {
+		setCondition(clientResource, httpapiv2.ConditionReady, metav1.ConditionFalse, httpapiv2.ReasonRolledBack, cond.Message)
+		return
+	}
+	for _, condType := range resourceConditions {
+		if !isConditionTrue(clientResource, condType) {
+			message := fmt.Sprintf("%s is not true", condType)
+			if cond := meta.FindStatusCondition(clientResource.Status.Conditions, condType); cond != nil && cond.Message != "" {
+				message = fmt.Sprintf("%s: %s", condType, cond.Message)
+			}
+			setCondition(clientResource, httpapiv2.ConditionReady, metav1.ConditionFalse, httpapiv2.ReasonResourcesNotReady, message)
+			return
+		}
+	}
+	setCondition(clientResource, httpapiv2.ConditionReady, metav1.ConditionTrue, httpapiv2.ReasonAllResourcesReady, "All managed resources are ready")
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// annotationConfigChecksum is the pod template annotation holding the checksum of the ConfigMaps and Secrets
+// referenced by the application container, the pods are rolled when it changes
+const annotationConfigChecksum = "httpapi.github.com/config-checksum"
+
+// ConfigMapsAndSecretsUncached are the objects the client of the manager has to read directly from the API server. Only
+// the metadata of the ConfigMaps and Secrets is watched, so their data (e.g. all the Secrets of the cluster) is not cached.
+var ConfigMapsAndSecretsUncached = []client.Object{&corev1.ConfigMap{}, &corev1.Secret{}}
+
+// field indexes of EasyHttp listing the names of the referenced ConfigMaps and Secrets
+const (
+	indexConfigMapRefs = ".spec.container.configMapRefs"
+	indexSecretRefs    = ".spec.container.secretRefs"
+)
+
+// referencedConfigMaps returns the sorted names of the ConfigMaps referenced by the env of clientResource
+func referencedConfigMaps(clientResource *httpapiv2.EasyHttp) []string {
+	names := map[string]bool{}
+	for _, e := range clientResource.Spec.Container.Env {
+		if e.ValueFrom != nil && e.ValueFrom.ConfigMapKeyRef != nil {
+			names[e.ValueFrom.ConfigMapKeyRef.Name] = true
+		}
+	}
+	for _, e := range clientResource.Spec.Container.EnvFrom {
+		if e.ConfigMapRef != nil {
+			names[e.ConfigMapRef.Name] = true
+		}
+	}
+	return sortedNames(names)
+}
+
+// referencedSecrets returns the sorted names of the Secrets referenced by the env of clientResource
+func referencedSecrets(clientResource *httpapiv2.EasyHttp) []string {
+	names := map[string]bool{}
+	for _, e := range clientResource.Spec.Container.Env {
+		if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+			names[e.ValueFrom.SecretKeyRef.Name] = true
+		}
+	}
+	for _, e := range clientResource.Spec.Container.EnvFrom {
+		if e.SecretRef != nil {
+			names[e.SecretRef.Name] = true
+		}
+	}
+	return sortedNames(names)
+}
+
+func sortedNames(names map[string]bool) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	ret := make([]string, 0, len(names))
+	for name := range names {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// configChecksum returns the checksum of the data of the ConfigMaps and Secrets referenced by clientResource,
+// empty when nothing is referenced. A missing object changes the checksum too, so the pods are rolled when it is created.
+func (r *EasyHttpReconciler) configChecksum(ctx context.Context, clientResource *httpapiv2.EasyHttp) (string, error) {
+	configMaps := referencedConfigMaps(clientResource)
+	secrets := referencedSecrets(clientResource)
+	if len(configMaps) == 0 && len(secrets) == 0 {
+		return "", nil
+	}
+
+	h := sha256.New()
+	for _, name := range configMaps {
+		cm := &corev1.ConfigMap{}
+		err := r.Client.Get(ctx, client.ObjectKey{Namespace: clientResource.Namespace, Name: name}, cm)
+		if err != nil && !errors.IsNotFound(err) {
+			return "", fmt.Errorf("cannot get configmap %s. %v", name, err)
+		}
+		fmt.Fprintf(h, "configmap/%s\n", name)
+		if err != nil {
+			fmt.Fprint(h, "missing\n")
+			continue
+		}
+		for _, k := range sortedKeys(cm.Data) {
+			hashEntry(h, k, []byte(cm.Data[k]))
+		}
+		for _, k := range sortedKeys(cm.BinaryData) {
+			hashEntry(h, k, cm.BinaryData[k])
+		}
+	}
+	for _, name := range secrets {
+		secret := &corev1.Secret{}
+		err := r.Client.Get(ctx, client.ObjectKey{Namespace: clientResource.Namespace, Name: name}, secret)
+		if err != nil && !errors.IsNotFound(err) {
+			return "", fmt.Errorf("cannot get secret %s. %v", name, err)
+		}
+		fmt.Fprintf(h, "secret/%s\n", name)
+		if err != nil {
+			fmt.Fprint(h, "missing\n")
+			continue
+		}
+		for _, k := range sortedKeys(secret.Data) {
+			hashEntry(h, k, secret.Data[k])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashEntry writes a length prefixed key-value pair into h, so different entries cannot produce the same input
+func hashEntry(h hash.Hash, key string, value []byte) {
+	fmt.Fprintf(h, "%d:%s=%d:", len(key), key, len(value))
+	h.Write(value)
+	fmt.Fprint(h, "\n")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// indexConfigMapRefsFunc is the field index function of indexConfigMapRefs
+func indexConfigMapRefsFunc(obj client.Object) []string {
+	return referencedConfigMaps(obj.(*httpapiv2.EasyHttp))
+}
+
+// indexSecretRefsFunc is the field index function of indexSecretRefs
+func indexSecretRefsFunc(obj client.Object) []string {
+	return referencedSecrets(obj.(*httpapiv2.EasyHttp))
+}
+
+// requestsForConfigMap returns the reconcile requests of the EasyHttps referencing the ConfigMap obj
+func (r *EasyHttpReconciler) requestsForConfigMap(obj client.Object) []reconcile.Request {
+	return r.requestsForReferenced(obj, indexConfigMapRefs)
+}
+
+// requestsForSecret returns the reconcile requests of the EasyHttps referencing the Secret obj
+func (r *EasyHttpReconciler) requestsForSecret(obj client.Object) []reconcile.Request {
+	return r.requestsForReferenced(obj, indexSecretRefs)
+}
+
+// requestsForReferenced returns the reconcile requests of the EasyHttps in the namespace of obj whose index field contains its name
+func (r *EasyHttpReconciler) requestsForReferenced(obj client.Object, index string) []reconcile.Request {
+	ctx := context.Background()
+	list := &httpapiv2.EasyHttpList{}
+	err := r.List(ctx, list, client.InNamespace(obj.GetNamespace()), client.MatchingFields{index: obj.GetName()})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "cannot list EasyHttps referencing object", "object", obj.GetName(), "index", index)
+		return nil
+	}
+	var ret []reconcile.Request
+	for _, item := range list.Items {
+		ret = append(ret, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+	}
+	return ret
+}
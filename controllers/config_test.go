@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// withConfigRefs makes the container of clientResource refer to the ConfigMap app and the Secrets db and api
+func withConfigRefs(clientResource *httpapiv2.EasyHttp) *httpapiv2.EasyHttp {
+	clientResource.Spec.Container.Env = []httpapiv2.EnvVar{
+		{Name: "PORT", Value: "1234"},
+		{Name: "PASSWORD", ValueFrom: &httpapiv2.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}}},
+		{Name: "MODE", ValueFrom: &httpapiv2.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Key: "mode"}}},
+	}
+	clientResource.Spec.Container.EnvFrom = []corev1.EnvFromSource{
+		{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}},
+		{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "api"}}},
+	}
+	return clientResource
+}
+
+func TestReferencedConfig(t *testing.T) {
+	clientResource := withConfigRefs(newTestResource())
+
+	assert.Equal(t, []string{"app"}, referencedConfigMaps(clientResource))
+	assert.Equal(t, []string{"api", "db"}, referencedSecrets(clientResource))
+
+	clientResource.Spec.Container.Env = nil
+	clientResource.Spec.Container.EnvFrom = nil
+	assert.Nil(t, referencedConfigMaps(clientResource))
+	assert.Nil(t, referencedSecrets(clientResource))
+}
+
+func TestConfigChecksum(t *testing.T) {
+	reconciler, _ := setup(t)
+	ctx := context.Background()
+	clientResource := withConfigRefs(newTestResource())
+
+	cm := &corev1.ConfigMap{Data: map[string]string{"mode": "prod"}}
+	db := &corev1.Secret{Data: map[string][]byte{"password": []byte("secret")}}
+	expectGets := func(cm *corev1.ConfigMap) {
+		clientMock.On("Get", mock.Anything, client.ObjectKey{Namespace: "namespace1", Name: "app"}, mock.AnythingOfType("*v1.ConfigMap")).Return(nil).Run(getReturns(cm)).Once()
+		clientMock.On("Get", mock.Anything, client.ObjectKey{Namespace: "namespace1", Name: "api"}, mock.AnythingOfType("*v1.Secret")).Return(errors.NewNotFound(schema.GroupResource{}, "api")).Once()
+		clientMock.On("Get", mock.Anything, client.ObjectKey{Namespace: "namespace1", Name: "db"}, mock.AnythingOfType("*v1.Secret")).Return(nil).Run(getReturns(db)).Once()
+	}
+	defer clientMock.AssertExpectations(t)
+
+	expectGets(cm)
+	checksum, err := reconciler.configChecksum(ctx, clientResource)
+	assert.NoError(t, err)
+	assert.Len(t, checksum, 64)
+
+	// the same data gives the same checksum
+	expectGets(cm)
+	same, err := reconciler.configChecksum(ctx, clientResource)
+	assert.NoError(t, err)
+	assert.Equal(t, checksum, same)
+
+	// changed data gives another checksum
+	expectGets(&corev1.ConfigMap{Data: map[string]string{"mode": "dev"}})
+	changed, err := reconciler.configChecksum(ctx, clientResource)
+	assert.NoError(t, err)
+	assert.NotEqual(t, checksum, changed)
+
+	// nothing referenced
+	clientResource.Spec.Container.Env = nil
+	clientResource.Spec.Container.EnvFrom = nil
+	empty, err := reconciler.configChecksum(ctx, clientResource)
+	assert.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func TestConfigChecksumGetFailed(t *testing.T) {
+	reconciler, _ := setup(t)
+	clientResource := withConfigRefs(newTestResource())
+
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.ConfigMap")).Return(errors.NewServiceUnavailable("boom")).Once()
+	defer clientMock.AssertExpectations(t)
+
+	_, err := reconciler.configChecksum(context.Background(), clientResource)
+	assert.Error(t, err)
+}
+
+func TestRequestsForConfigMap(t *testing.T) {
+	reconciler, _ := setup(t)
+	cm := &corev1.ConfigMap{}
+	cm.Name = "app"
+	cm.Namespace = "namespace1"
+
+	clientMock.On("List", mock.Anything, mock.AnythingOfType("*v2.EasyHttpList"), client.InNamespace("namespace1"),
+		client.MatchingFields{indexConfigMapRefs: "app"}).Return(nil).Run(func(args mock.Arguments) {
+		list := args.Get(1).(*httpapiv2.EasyHttpList)
+		list.Items = []httpapiv2.EasyHttp{*withConfigRefs(newTestResource())}
+	}).Once()
+	defer clientMock.AssertExpectations(t)
+
+	requests := reconciler.requestsForConfigMap(cm)
+
+	assert.Equal(t, []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: "namespace1", Name: "app1"}}}, requests)
+}
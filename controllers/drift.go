@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The in sync functions compare the operator-owned fields of the live object with the desired one.
+// Fields not rendered by the operator (defaulted by the API server or owned by other field managers,
+// e.g. env vars added by a mesh injector) are ignored. The desired object is server-side applied when
+// they are not in sync, which restores the operator-owned fields.
+
+// deploymentInSync returns true if the operator-owned fields of live deployment are the desired ones
+func deploymentInSync(desired, live *appsv1.Deployment) bool {
+	return equality.Semantic.DeepDerivative(desired.Labels, live.Labels) &&
+		equality.Semantic.DeepDerivative(desired.Annotations, live.Annotations) &&
+		equality.Semantic.DeepDerivative(desired.Spec, live.Spec)
+}
+
+// serviceInSync returns true if the operator-owned fields of live service are the desired ones
+func serviceInSync(desired, live *corev1.Service) bool {
+	return equality.Semantic.DeepDerivative(desired.Labels, live.Labels) &&
+		equality.Semantic.DeepDerivative(desired.Annotations, live.Annotations) &&
+		equality.Semantic.DeepDerivative(desired.Spec, live.Spec)
+}
+
+// ingressInSync returns true if the operator-owned fields of live ingress are the desired ones
+func ingressInSync(desired, live *netv1.Ingress) bool {
+	return equality.Semantic.DeepDerivative(desired.Labels, live.Labels) &&
+		equality.Semantic.DeepDerivative(desired.Annotations, live.Annotations) &&
+		equality.Semantic.DeepDerivative(desired.Spec, live.Spec)
+}
+
+// middlewareInSync returns true if the operator-owned fields of live middleware are the desired ones
+func middlewareInSync(desired, live *unstructured.Unstructured) bool {
+	return equality.Semantic.DeepDerivative(desired.GetLabels(), live.GetLabels()) &&
+		equality.Semantic.DeepDerivative(desired.GetAnnotations(), live.GetAnnotations()) &&
+		equality.Semantic.DeepDerivative(desired.Object["spec"], live.Object["spec"])
+}
+
+// horizontalPodAutoscalerInSync returns true if the operator-owned fields of live autoscaler are the desired ones
+func horizontalPodAutoscalerInSync(desired, live *autoscalingv2.HorizontalPodAutoscaler) bool {
+	return equality.Semantic.DeepDerivative(desired.Labels, live.Labels) &&
+		equality.Semantic.DeepDerivative(desired.Annotations, live.Annotations) &&
+		equality.Semantic.DeepDerivative(desired.Spec, live.Spec)
+}
+
+// podDisruptionBudgetInSync returns true if the operator-owned fields of live disruption budget are the desired ones
+func podDisruptionBudgetInSync(desired, live *policyv1.PodDisruptionBudget) bool {
+	return equality.Semantic.DeepDerivative(desired.Labels, live.Labels) &&
+		equality.Semantic.DeepDerivative(desired.Annotations, live.Annotations) &&
+		equality.Semantic.DeepDerivative(desired.Spec, live.Spec)
+}
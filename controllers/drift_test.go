@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDeploymentInSync(t *testing.T) {
+	clientResource := newTestResource()
+	clientResource.Spec.Container.Env = []httpapiv2.EnvVar{{Name: "MODE", Value: "prod"}, {Name: "PORT", Value: "1234"}}
+	desired := initDeployment(clientResource, deploymentParams{})
+
+	// fields defaulted by the API server are not drift
+	live := initDeployment(clientResource, deploymentParams{})
+	live.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+	live.Spec.Template.Spec.Containers[0].Ports[0].Protocol = corev1.ProtocolTCP
+	live.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	assert.True(t, deploymentInSync(desired, live))
+
+	live.Spec.Template.Spec.Containers[0].Image = "manual:edit"
+	assert.False(t, deploymentInSync(desired, live))
+
+	// extra env var added by an other field manager is not drift
+	live = initDeployment(clientResource, deploymentParams{})
+	live.Spec.Template.Spec.Containers[0].Env = append(live.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "DEBUG", Value: "1"})
+	assert.True(t, deploymentInSync(desired, live))
+
+	live.Spec.Template.Spec.Containers[0].Env[0].Value = "changed"
+	assert.False(t, deploymentInSync(desired, live))
+}
+
+func TestServiceInSync(t *testing.T) {
+	clientResource := newTestResource()
+	desired := initService(clientResource)
+
+	live := initService(clientResource)
+	live.Spec.ClusterIP = "10.0.0.1"
+	live.Spec.Type = corev1.ServiceTypeClusterIP
+	assert.True(t, serviceInSync(desired, live))
+
+	live.Spec.Selector = map[string]string{"app": "other"}
+	assert.False(t, serviceInSync(desired, live))
+}
+
+func TestIngressInSync(t *testing.T) {
+	clientResource := newTestResource()
+	desired := initIngress(clientResource, "app1-svc")
+
+	// ingress class set by the default ingress class admission and foreign annotations are not drift
+	live := initIngress(clientResource, "app1-svc")
+	className := "nginx"
+	live.Spec.IngressClassName = &className
+	live.Annotations["foreign"] = "value"
+	assert.True(t, ingressInSync(desired, live))
+
+	live.Annotations[annotationNginxRewriteTarget] = "/"
+	assert.False(t, ingressInSync(desired, live))
+
+	live = initIngress(clientResource, "app1-svc")
+	live.Spec.Rules[0].Host = "other.host"
+	assert.False(t, ingressInSync(desired, live))
+}
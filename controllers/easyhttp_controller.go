@@ -18,19 +18,32 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	v1 "k8s.io/api/core/v1"
 	netv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	httpapiv1 "github.com/akosbalogh005/easyhttp-operator/api/v1"
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
 )
 
 // for mocking purposes
@@ -54,19 +67,41 @@ type SubResourceWriterIF interface {
 	client.SubResourceWriter
 }
 
+// fieldManager is the field manager of the resources applied by the operator
+const fieldManager = "easyhttp-operator"
+
+// handoverFieldManager keeps the replicas of the Deployment when they are handed over to the autoscaler, so they are not
+// reset when the operator stops applying them
+const handoverFieldManager = "easyhttp-operator-handover"
+
+// certificateRequeueDelay is the delay of the next reconcile while the TLS secret has not been issued yet
+const certificateRequeueDelay = 30 * time.Second
+
 // EasyHttpReconciler reconciles a EasyHttp object
 type EasyHttpReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// SizePresets are the resource presets which can be selected in the EasyHttp resources
+	SizePresets SizePresets
 }
 
 //+kubebuilder:rbac:groups=httpapi.github.com,resources=easyhttps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=httpapi.github.com,resources=easyhttps/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=httpapi.github.com,resources=easyhttps/finalizers,verbs=update
 //+kubebuilder:rbac:groups="apps",resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="apps",resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="apps",resources=replicasets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="autoscaling",resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="policy",resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="extensions",resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="traefik.io",resources=middlewares,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -81,194 +116,531 @@ func (r *EasyHttpReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	log := log.FromContext(ctx)
 
 	// get the resource
-	var clientResource = &httpapiv1.EasyHttp{}
+	var clientResource = &httpapiv2.EasyHttp{}
 	if err := r.Get(ctx, req.NamespacedName, clientResource); err != nil {
 		log.Info(fmt.Sprintf("Reconcile loop is running, client may be deleted... Client:%v.%v, Owner:%v, Spec:%v, Status:%v", clientResource.Namespace, clientResource.Name,
 			clientResource.OwnerReferences, clientResource.Status, clientResource.Spec))
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	specHasChanged := false
-	// spec has changed
-	if clientResource.Status.IsDeployOK {
-		if !clientResource.Spec.IsEqual(&clientResource.Status.Spec) {
-			log.Info(fmt.Sprintf("Spec is differ, reconfigure. Orig: %v, New: %v", clientResource.Spec, clientResource.Status.Spec))
-			clientResource.Status.IsDeployOK = false
-			clientResource.Status.IsSvcOK = false
-			clientResource.Status.IsIngressOK = false
-			specHasChanged = true
-		}
+	// one-off operations requested by annotation change the spec, which is reconciled in the next loop
+	if action, ok := clientResource.Annotations[httpapiv2.AnnotationAction]; ok {
+		return r.runAction(ctx, clientResource, action)
 	}
-	clientResource.Spec.DeepCopyInto(&clientResource.Status.Spec)
-	err := r.Status().Update(context.TODO(), clientResource)
-	if err != nil {
-		log.Error(err, "failed to update client status")
-		return ctrl.Result{}, err
+	if revision, ok := clientResource.Annotations[httpapiv2.AnnotationRollbackTo]; ok {
+		return r.rollbackToRevision(ctx, clientResource, revision)
+	}
+	// spec has changed since the last successful reconcile
+	specHasChanged := clientResource.Status.ObservedGeneration != 0 && clientResource.Status.ObservedGeneration != clientResource.Generation
+	if specHasChanged {
+		log.Info(fmt.Sprintf("Spec has changed, reconfigure. Observed generation: %v, New generation: %v", clientResource.Status.ObservedGeneration, clientResource.Generation))
+		r.Recorder.Eventf(clientResource, v1.EventTypeNormal, httpapiv2.ReasonSpecChanged,
+			"Specification has changed (generation %d -> %d), reconfiguring", clientResource.Status.ObservedGeneration, clientResource.Generation)
+		for _, condType := range []string{httpapiv2.ConditionDeploymentReady, httpapiv2.ConditionAutoscalerReady,
+			httpapiv2.ConditionDisruptionBudgetReady, httpapiv2.ConditionServiceReady, httpapiv2.ConditionIngressReady} {
+			setCondition(clientResource, condType, metav1.ConditionFalse, httpapiv2.ReasonSpecChanged, "Specification has changed, reconfiguring")
+		}
+		err := r.Status().Update(context.TODO(), clientResource)
+		if err != nil {
+			log.Error(err, "failed to update client status")
+			return ctrl.Result{}, err
+		}
 	}
 
 	log.Info(fmt.Sprintf("Reconcile loop is running... Client:%v.%v, Owner:%v, Spec:%v,  Status:%v", clientResource.Namespace, clientResource.Name,
 		clientResource.OwnerReferences, clientResource.Status, clientResource.Spec))
 
-	// 1st step is check if the deployment is ready.
-	ret, err := r.CheckDeployment(ctx, req, specHasChanged, clientResource)
+	// 1st step is check if the deployment is ready. The BlueGreen strategy has two deployments and services,
+	// the service of the active one is used by the ingress
+	blueGreen := clientResource.Spec.Strategy.Type == httpapiv2.StrategyBlueGreen
+	var ret ctrl.Result
+	var err error
+	var svc *v1.Service
+	switched := false
+	if blueGreen {
+		// the failed rollouts are not promoted instead of being rolled back
+		setCondition(clientResource, httpapiv2.ConditionRolledBack, metav1.ConditionFalse, httpapiv2.ReasonNoRollback,
+			"Rollback is not used by the BlueGreen strategy")
+		ret, svc, switched, err = r.CheckBlueGreen(ctx, req, specHasChanged, clientResource)
+	} else {
+		setCondition(clientResource, httpapiv2.ConditionPreviewReady, metav1.ConditionTrue, httpapiv2.ReasonNoPreview, "There is no preview")
+		ret, err = r.CheckDeployment(ctx, req, specHasChanged, clientResource)
+	}
+	if err != nil {
+		return r.failed(ctx, clientResource, ret, err)
+	}
+
+	result := ret
+
+	// 2nd step is the autoscaler of the deployment
+	ret, err = r.CheckAutoscaler(ctx, req, specHasChanged, clientResource)
 	if err != nil {
-		return ret, err
+		return r.failed(ctx, clientResource, ret, err)
 	}
 
-	// 2nd step is the service
-	ret, svc, err := r.CheckService(ctx, req, specHasChanged, clientResource)
+	// 3rd step is the disruption budget of the pods
+	ret, err = r.CheckDisruptionBudget(ctx, req, specHasChanged, clientResource)
 	if err != nil {
-		return ret, err
+		return r.failed(ctx, clientResource, ret, err)
 	}
 
-	// 3rd step is the ingress
-	ret, err = r.CheckIngress(ctx, req, specHasChanged, clientResource, svc)
+	// 4th step is the service
+	if !blueGreen {
+		ret, svc, err = r.CheckService(ctx, req, specHasChanged, clientResource)
+		if err != nil {
+			return r.failed(ctx, clientResource, ret, err)
+		}
+	}
+
+	// 5th step is the ingress, it is switched to the other color when the preview has been promoted
+	ret, err = r.CheckIngress(ctx, req, specHasChanged || switched, clientResource, svc)
 	if err != nil {
-		return ret, err
+		return r.failed(ctx, clientResource, ret, err)
+	}
+	if switched {
+		// the previous color is removed in the next loop, after the ingress has been switched
+		result = earliestResult(result, ctrl.Result{RequeueAfter: rolloutRequeueDelay})
 	}
 
+	// the resources of the previous strategy are removed when the ingress routes to the ready resources of the current one
+	if err = r.CheckStrategyCleanup(ctx, clientResource); err != nil {
+		return r.failed(ctx, clientResource, ctrl.Result{Requeue: true}, err)
+	}
+
+	// 6th step is the canary, its ingress requires the ingress of the application
+	ret, err = r.CheckCanary(ctx, req, specHasChanged, clientResource)
+	if err != nil {
+		return r.failed(ctx, clientResource, ret, err)
+	}
+	result = earliestResult(result, ret)
+
+	// 7th step is the certificate (secret) issued by cert manager
+	ret, err = r.CheckCertificate(ctx, req, clientResource)
+	if err != nil {
+		return r.failed(ctx, clientResource, ret, err)
+	}
+	result = earliestResult(result, ret)
+
+	// 8th step is the revision history, the applied spec is recorded for rollback
+	if err = r.CheckRevisionHistory(ctx, clientResource); err != nil {
+		return r.failed(ctx, clientResource, ctrl.Result{Requeue: true}, err)
+	}
+
+	wasReady := isConditionTrue(clientResource, httpapiv2.ConditionReady)
+	updateReadyCondition(clientResource)
+	if !wasReady && isConditionTrue(clientResource, httpapiv2.ConditionReady) {
+		r.Recorder.Event(clientResource, v1.EventTypeNormal, httpapiv2.ReasonAllResourcesReady, "All managed resources are ready")
+	}
+	clientResource.Status.ObservedGeneration = clientResource.Generation
 	err = r.Status().Update(context.TODO(), clientResource)
 	if err != nil {
 		log.Error(err, "failed to update client status")
 	}
 
-	if clientResource.Spec.CertManInssuer == "" {
+	return result, nil
+	//return ctrl.Result{Requeue: true}, nil
+	//return ctrl.Result{RequeueAfter: time.Minute * 60}, nil
+}
+
+// failed updates the Ready condition of clientResource after a failed reconcile step and returns the original result and error
+func (r *EasyHttpReconciler) failed(ctx context.Context, clientResource *httpapiv2.EasyHttp, ret ctrl.Result, reconcileErr error) (ctrl.Result, error) {
+	updateReadyCondition(clientResource)
+	if err := r.Status().Update(ctx, clientResource); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update client status")
+	}
+	return ret, reconcileErr
+}
+
+// CheckCertificate checks if the TLS secret requested by the ingress has been issued by cert manager
+func (r *EasyHttpReconciler) CheckCertificate(ctx context.Context, req ctrl.Request, clientResource *httpapiv2.EasyHttp) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if clientResource.Spec.TLS.Issuer == "" {
 		log.Info("Certificate manager is disabled. Add certManIssuer to kind spec if necessary")
-	} else {
-		log.Info(fmt.Sprintf("Using Certificate manager: %v", clientResource.Spec.CertManInssuer))
+		setCondition(clientResource, httpapiv2.ConditionCertificateReady, metav1.ConditionTrue, httpapiv2.ReasonCertDisabled, "Certificate manager is disabled")
+		return ctrl.Result{}, nil
 	}
+	log.Info(fmt.Sprintf("Using Certificate manager: %v", clientResource.Spec.TLS.Issuer))
 
-	return ctrl.Result{Requeue: false}, nil
-	//return ctrl.Result{Requeue: true}, nil
-	//return ctrl.Result{RequeueAfter: time.Minute * 60}, nil
+	secret := &v1.Secret{}
+	secretName := tlsSecretName(clientResource)
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: clientResource.Namespace, Name: secretName}, secret)
+	if err != nil && errors.IsNotFound(err) {
+		setCondition(clientResource, httpapiv2.ConditionCertificateReady, metav1.ConditionFalse, httpapiv2.ReasonCertPending,
+			fmt.Sprintf("Waiting for issuer %s to issue secret %s", clientResource.Spec.TLS.Issuer, secretName))
+		return ctrl.Result{RequeueAfter: certificateRequeueDelay}, nil
+	} else if err != nil {
+		err = fmt.Errorf("cannot get certificate secret, retying later. %v", err)
+		r.reconcileFailed(clientResource, httpapiv2.ConditionCertificateReady, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	setCondition(clientResource, httpapiv2.ConditionCertificateReady, metav1.ConditionTrue, httpapiv2.ReasonCertIssued,
+		fmt.Sprintf("Secret %s has been issued by %s", secretName, clientResource.Spec.TLS.Issuer))
+	return ctrl.Result{}, nil
+}
+
+// replicasApplied returns true if the replicas of dep are owned by the operator field manager
+func replicasApplied(dep *appsv1.Deployment) bool {
+	for _, entry := range dep.ManagedFields {
+		if entry.Manager != fieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]map[string]interface{}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return false
+		}
+		_, ok := fields["f:spec"]["f:replicas"]
+		return ok
+	}
+	return false
 }
 
-func (r *EasyHttpReconciler) CheckIngress(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv1.EasyHttp, svc *v1.Service) (ctrl.Result, error) {
+// handOverReplicas applies the live replicas of dep with the handover field manager before the operator stops applying
+// them (autoscaling is turned on). Without another owner the replicas would be reset to 1 until the autoscaler scales the
+// Deployment, as described by the server-side apply documentation of Kubernetes.
+func (r *EasyHttpReconciler) handOverReplicas(ctx context.Context, dep *appsv1.Deployment) error {
+	handover := &unstructured.Unstructured{}
+	handover.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	handover.SetName(dep.Name)
+	handover.SetNamespace(dep.Namespace)
+	handover.Object["spec"] = map[string]interface{}{"replicas": int64(*dep.Spec.Replicas)}
+	if err := r.Patch(ctx, handover, client.Apply, client.FieldOwner(handoverFieldManager)); err != nil {
+		return fmt.Errorf("cannot hand over the replicas of deployment %s, retying later. %v", dep.Name, err)
+	}
+	log.FromContext(ctx).Info(fmt.Sprintf("Replicas of deployment %v have been handed over to the autoscaler", dep.Name))
+	return nil
+}
+
+// CheckAutoscaler applies the HorizontalPodAutoscaler when autoscaling is on and it is new, the spec has changed or its
+// operator-owned fields differ from the desired ones. The autoscaler created by the operator is deleted when autoscaling is off.
+func (r *EasyHttpReconciler) CheckAutoscaler(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv2.EasyHttp) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
-	ing := initIngress(clientResource, svc.Name)
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
 
-	// try to get the current service  ...
-	err := r.Client.Get(ctx, client.ObjectKey{Namespace: ing.Namespace, Name: ing.ObjectMeta.Name}, ing)
+	// try to get the current autoscaler ...
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: clientResource.Namespace, Name: clientResource.Name}, hpa)
 
 	isNew := false
 	if err != nil && errors.IsNotFound(err) {
-		// (re)deploy
 		isNew = true
-		clientResource.Status.IsIngressOK = false
 	} else if err != nil {
-		return ctrl.Result{Requeue: true}, fmt.Errorf("cannot get ingress, retying later. %v", err)
+		err = fmt.Errorf("cannot get horizontal pod autoscaler, retying later. %v", err)
+		r.reconcileFailed(clientResource, httpapiv2.ConditionAutoscalerReady, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if clientResource.Spec.Scaling.Autoscaling == nil {
+		if !isNew {
+			if err = r.deleteOwned(ctx, hpa, "HorizontalPodAutoscaler", clientResource, httpapiv2.ConditionAutoscalerReady); err != nil {
+				return ctrl.Result{Requeue: true}, err
+			}
+		}
+		setCondition(clientResource, httpapiv2.ConditionAutoscalerReady, metav1.ConditionTrue, httpapiv2.ReasonAutoscalerOff, "Autoscaling is off")
+		return ctrl.Result{}, nil
+	}
+
+	newHpa := initHorizontalPodAutoscaler(clientResource)
+	if isNew || specHasChanged || !horizontalPodAutoscalerInSync(newHpa, hpa) {
+		err = r.apply(ctx, req, newHpa, hpa, clientResource, httpapiv2.ConditionAutoscalerReady, isNew, specHasChanged)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply horizontal pod autoscaler. %v", err)
+		}
+		hpa = newHpa
+		log.Info("HorizontalPodAutoscaler has been successfuly applied :)")
 	} else {
-		// when current found, update the Spec in order to refresh specification if needed
-		if specHasChanged {
-			newIng := initIngress(clientResource, svc.Name)
-			ing.Spec = *newIng.Spec.DeepCopy()
-			ing.Annotations = newIng.Annotations
+		markInSync(clientResource, httpapiv2.ConditionAutoscalerReady, hpa.Name)
+	}
+	log.Info(fmt.Sprintf("Current HorizontalPodAutoscaler is: %v (%v)", hpa.Name, hpa.UID))
+	return ctrl.Result{}, nil
+}
+
+// CheckDisruptionBudget applies the PodDisruptionBudget when it is required and it is new, the spec has changed or its
+// operator-owned fields differ from the desired ones. The budget created by the operator is deleted when it is not required.
+func (r *EasyHttpReconciler) CheckDisruptionBudget(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv2.EasyHttp) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	pdb := &policyv1.PodDisruptionBudget{}
+
+	// try to get the current disruption budget ...
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: clientResource.Namespace, Name: clientResource.Name}, pdb)
+
+	isNew := false
+	if err != nil && errors.IsNotFound(err) {
+		isNew = true
+	} else if err != nil {
+		err = fmt.Errorf("cannot get pod disruption budget, retying later. %v", err)
+		r.reconcileFailed(clientResource, httpapiv2.ConditionDisruptionBudgetReady, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if !disruptionBudgetRequired(clientResource) {
+		if !isNew {
+			if err = r.deleteOwned(ctx, pdb, "PodDisruptionBudget", clientResource, httpapiv2.ConditionDisruptionBudgetReady); err != nil {
+				return ctrl.Result{Requeue: true}, err
+			}
+		}
+		message := "Disruption budget is not required for a single replica"
+		if clientResource.Spec.Strategy.Type == httpapiv2.StrategyBlueGreen {
+			message = "Disruption budget is not supported by the BlueGreen strategy"
 		}
+		setCondition(clientResource, httpapiv2.ConditionDisruptionBudgetReady, metav1.ConditionTrue, httpapiv2.ReasonNotRequired, message)
+		return ctrl.Result{}, nil
 	}
 
-	if !clientResource.Status.IsIngressOK {
-		err = r.createOrUpdate(ctx, req, ing, clientResource, &clientResource.Status.IsIngressOK, isNew)
+	newPdb := initPodDisruptionBudget(clientResource)
+	if isNew || specHasChanged || !podDisruptionBudgetInSync(newPdb, pdb) {
+		err = r.apply(ctx, req, newPdb, pdb, clientResource, httpapiv2.ConditionDisruptionBudgetReady, isNew, specHasChanged)
 		if err != nil {
-			return ctrl.Result{Requeue: true}, fmt.Errorf("failed to create ingress. %v", err)
+			return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply pod disruption budget. %v", err)
 		}
-		log.Info("Ingress has been successfuly created/updated :)")
+		pdb = newPdb
+		log.Info("PodDisruptionBudget has been successfuly applied :)")
+	} else {
+		markInSync(clientResource, httpapiv2.ConditionDisruptionBudgetReady, pdb.Name)
 	}
-	log.Info(fmt.Sprintf("Current Ingress is: %v (%v)", ing.Name, ing.UID))
+	log.Info(fmt.Sprintf("Current PodDisruptionBudget is: %v (%v)", pdb.Name, pdb.UID))
 	return ctrl.Result{}, nil
 }
 
-func (r *EasyHttpReconciler) CheckService(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv1.EasyHttp) (ctrl.Result, *v1.Service, error) {
+// CheckIngress applies the ingress when it is new, the spec has changed or its operator-owned fields differ from the desired ones.
+// With the BlueGreen strategy the ingress is built from the active spec.
+func (r *EasyHttpReconciler) CheckIngress(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv2.EasyHttp, svc *v1.Service) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
-	svc := initService(clientResource)
+	// the middleware referenced by the ingress is applied first
+	if err := r.CheckMiddleware(ctx, req, specHasChanged, clientResource); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+	routed := routedResource(clientResource)
+	newIng := initIngress(routed, svc.Name)
+	ing := &netv1.Ingress{}
 
-	// try to get the current service  ...
-	err := r.Client.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: svc.ObjectMeta.Name}, svc)
+	// try to get the current ingress  ...
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: newIng.Namespace, Name: newIng.ObjectMeta.Name}, ing)
 
 	isNew := false
 	if err != nil && errors.IsNotFound(err) {
 		// (re)deploy
 		isNew = true
-		clientResource.Status.IsSvcOK = false
 	} else if err != nil {
-		return ctrl.Result{Requeue: true}, svc, fmt.Errorf("cannot get service, retying later. %v", err)
+		err = fmt.Errorf("cannot get ingress, retying later. %v", err)
+		r.reconcileFailed(clientResource, httpapiv2.ConditionIngressReady, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if isNew || specHasChanged || !ingressInSync(newIng, ing) {
+		err = r.apply(ctx, req, newIng, ing, clientResource, httpapiv2.ConditionIngressReady, isNew, specHasChanged)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply ingress. %v", err)
+		}
+		ing = newIng
+		log.Info("Ingress has been successfuly applied :)")
 	} else {
-		// when current found, update the Spec in order to refresh specification if needed
-		if specHasChanged {
-			newSvc := initService(clientResource)
-			svc.Spec = *newSvc.Spec.DeepCopy()
+		markInSync(clientResource, httpapiv2.ConditionIngressReady, ing.Name)
+	}
+	log.Info(fmt.Sprintf("Current Ingress is: %v (%v)", ing.Name, ing.UID))
+
+	// the rewritten routes are routed by a separate ingress when the provider cannot rewrite them in the same one
+	if newRewrite := initRewriteIngress(routed, svc.Name); newRewrite == nil {
+		rewrite := &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: clientResource.Name + "-rewrite-ingress"}}
+		if err = r.removeOwned(ctx, rewrite, "Ingress", clientResource, httpapiv2.ConditionIngressReady); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+	} else {
+		rewrite := &netv1.Ingress{}
+		if _, err = r.ensure(ctx, req, newRewrite, rewrite, func() bool { return ingressInSync(newRewrite, rewrite) }, clientResource,
+			httpapiv2.ConditionIngressReady, specHasChanged); err != nil {
+			return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply rewrite ingress. %v", err)
+		}
+	}
+
+	// the aliases are redirected to the host by a separate ingress
+	if !routed.Spec.RedirectAliases {
+		redirect := &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: clientResource.Namespace, Name: clientResource.Name + "-redirect-ingress"}}
+		if err = r.removeOwned(ctx, redirect, "Ingress", clientResource, httpapiv2.ConditionIngressReady); err != nil {
+			return ctrl.Result{Requeue: true}, err
 		}
+		return ctrl.Result{}, nil
 	}
+	newRedirect := initRedirectIngress(routed, svc.Name)
+	redirect := &netv1.Ingress{}
+	if _, err = r.ensure(ctx, req, newRedirect, redirect, func() bool { return ingressInSync(newRedirect, redirect) }, clientResource,
+		httpapiv2.ConditionIngressReady, specHasChanged); err != nil {
+		return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply redirect ingress. %v", err)
+	}
+	return ctrl.Result{}, nil
+}
 
-	if !clientResource.Status.IsSvcOK {
-		err = r.createOrUpdate(ctx, req, svc, clientResource, &clientResource.Status.IsSvcOK, isNew)
+// CheckService applies the service when it is new, the spec has changed or its operator-owned fields differ from the desired ones
+func (r *EasyHttpReconciler) CheckService(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv2.EasyHttp) (ctrl.Result, *v1.Service, error) {
+	log := log.FromContext(ctx)
+	newSvc := initService(clientResource)
+	svc := &v1.Service{}
+
+	// try to get the current service  ...
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: newSvc.Namespace, Name: newSvc.ObjectMeta.Name}, svc)
+
+	isNew := false
+	if err != nil && errors.IsNotFound(err) {
+		// (re)deploy
+		isNew = true
+	} else if err != nil {
+		err = fmt.Errorf("cannot get service, retying later. %v", err)
+		r.reconcileFailed(clientResource, httpapiv2.ConditionServiceReady, err)
+		return ctrl.Result{Requeue: true}, newSvc, err
+	}
+
+	if isNew || specHasChanged || !serviceInSync(newSvc, svc) {
+		err = r.apply(ctx, req, newSvc, svc, clientResource, httpapiv2.ConditionServiceReady, isNew, specHasChanged)
 		if err != nil {
-			return ctrl.Result{Requeue: true}, svc, fmt.Errorf("failed to create service. %v", err)
+			return ctrl.Result{Requeue: true}, newSvc, fmt.Errorf("failed to apply service. %v", err)
 		}
-		log.Info("Service has been successfuly created/updated :)")
+		svc = newSvc
+		log.Info("Service has been successfuly applied :)")
+	} else {
+		markInSync(clientResource, httpapiv2.ConditionServiceReady, svc.Name)
 	}
 	log.Info(fmt.Sprintf("Current Service is: %v (%v)", svc.Name, svc.UID))
 	return ctrl.Result{}, svc, nil
 }
 
-func (r *EasyHttpReconciler) CheckDeployment(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv1.EasyHttp) (ctrl.Result, error) {
+// CheckDeployment applies the deployment when it is new, the spec has changed or its operator-owned fields differ from
+// the desired ones, then reports the progress of its rollout. A failed rollout is rolled back to the last good spec.
+func (r *EasyHttpReconciler) CheckDeployment(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv2.EasyHttp) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
-	// init deployment struct
-	dep := initDeployment(clientResource)
+	params, err := r.deploymentParams(ctx, clientResource)
+	if err != nil {
+		r.reconcileFailed(clientResource, httpapiv2.ConditionDeploymentReady, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	// init deployment struct, the failed rollout of the current spec is replaced by the last good one
+	deployed := clientResource
+	if rolledBack(clientResource) {
+		deployed = rollbackResource(clientResource)
+	}
+	newDep := initDeployment(deployed, params)
+	dep := &appsv1.Deployment{}
 
 	// try to get the current running deployment ...
-	err := r.Client.Get(ctx, client.ObjectKey{Namespace: dep.Namespace, Name: dep.ObjectMeta.Name}, dep)
+	err = r.Client.Get(ctx, client.ObjectKey{Namespace: newDep.Namespace, Name: newDep.ObjectMeta.Name}, dep)
 
 	isNew := false
 	if err != nil && errors.IsNotFound(err) {
 		// (re)deploy
 		isNew = true
-		clientResource.Status.IsDeployOK = false
 	} else if err != nil {
-		return ctrl.Result{Requeue: true}, fmt.Errorf("cannot get deployment, retying later. %v", err)
-	} else {
-		// when current found, update the Spec in order to frefresh seecification
-		if specHasChanged {
-			newDep := initDeployment(clientResource)
-			dep.Spec = *newDep.Spec.DeepCopy()
+		err = fmt.Errorf("cannot get deployment, retying later. %v", err)
+		r.reconcileFailed(clientResource, httpapiv2.ConditionDeploymentReady, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if !isNew && newDep.Spec.Replicas == nil && dep.Spec.Replicas != nil && replicasApplied(dep) {
+		if err := r.handOverReplicas(ctx, dep); err != nil {
+			r.reconcileFailed(clientResource, httpapiv2.ConditionDeploymentReady, err)
+			return ctrl.Result{Requeue: true}, err
 		}
 	}
 
-	if !clientResource.Status.IsDeployOK {
-		err = r.createOrUpdate(ctx, req, dep, clientResource, &clientResource.Status.IsDeployOK, isNew)
+	configHasChanged := !isNew && dep.Spec.Template.Annotations[annotationConfigChecksum] != params.configChecksum
+	if configHasChanged {
+		log.Info(fmt.Sprintf("Referenced configuration has changed, rolling the pods of deployment %v", newDep.Name))
+		r.Recorder.Eventf(clientResource, v1.EventTypeNormal, httpapiv2.ReasonConfigChanged,
+			"Referenced ConfigMaps or Secrets have changed, rolling the pods of Deployment %s", newDep.Name)
+	}
+
+	if isNew || specHasChanged || configHasChanged || !deploymentInSync(newDep, dep) {
+		err = r.apply(ctx, req, newDep, dep, clientResource, httpapiv2.ConditionDeploymentReady, isNew, specHasChanged || configHasChanged)
 		if err != nil {
-			return ctrl.Result{Requeue: true}, fmt.Errorf("failed to create deployment. %v", err)
+			return ctrl.Result{Requeue: true}, fmt.Errorf("failed to apply deployment. %v", err)
 		}
-		log.Info("Deployment has been successfuly created/updated :)")
+		dep = newDep
+		log.Info("Deployment has been successfuly applied :)")
 	}
 	log.Info(fmt.Sprintf("Current Deployment is: %v (%v)", dep.Name, dep.UID))
 
-	return ctrl.Result{}, nil
+	// the applied deployment is ready only when its rollout has been completed
+	result := updateRolloutStatus(clientResource, dep)
+	if rolledBack(clientResource) {
+		return result, nil
+	}
+	failed, reason, message, err := r.rolloutFailure(ctx, clientResource, newDep, dep, params)
+	if err != nil {
+		r.reconcileFailed(clientResource, httpapiv2.ConditionDeploymentReady, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+	if failed {
+		if err := r.rollback(ctx, clientResource, reason, message); err != nil {
+			r.reconcileFailed(clientResource, httpapiv2.ConditionDeploymentReady, err)
+			return ctrl.Result{Requeue: true}, err
+		}
+		return r.CheckDeployment(ctx, req, true, clientResource)
+	}
+	setCondition(clientResource, httpapiv2.ConditionRolledBack, metav1.ConditionFalse, httpapiv2.ReasonNoRollback,
+		"Deployment runs the current specification")
+	if isConditionTrue(clientResource, httpapiv2.ConditionDeploymentReady) {
+		clientResource.Status.LastGoodSpec = clientResource.Spec.DeepCopy()
+	}
+	return result, nil
+}
+
+// deploymentParams resolves the inputs of the deployments of clientResource which are not part of the EasyHttp
+func (r *EasyHttpReconciler) deploymentParams(ctx context.Context, clientResource *httpapiv2.EasyHttp) (deploymentParams, error) {
+	// the pods are rolled when the referenced ConfigMaps or Secrets change
+	checksum, err := r.configChecksum(ctx, clientResource)
+	if err != nil {
+		return deploymentParams{}, fmt.Errorf("cannot compute checksum of the referenced configuration, retying later. %v", err)
+	}
+	resources, err := containerResources(clientResource, r.SizePresets)
+	if err != nil {
+		return deploymentParams{}, err
+	}
+	return deploymentParams{configChecksum: checksum, resources: resources}, nil
 }
 
-func (r *EasyHttpReconciler) createOrUpdate(ctx context.Context, req ctrl.Request, obj client.Object, clientResource *httpapiv1.EasyHttp, statusFlag *bool, isNew bool) error {
+// apply server-side applies the desired obj under the operator field manager, so only the fields rendered by the
+// operator are owned by it and other actors (autoscalers, mesh injectors, cert-manager) can own the rest.
+// live is the object read before the apply (empty when isNew), obj is updated with the applied object.
+// The condType condition of clientResource is set and an event is emitted according to the result.
+func (r *EasyHttpReconciler) apply(ctx context.Context, req ctrl.Request, obj, live client.Object, clientResource *httpapiv2.EasyHttp, condType string, isNew, specHasChanged bool) error {
 
 	log := log.FromContext(ctx)
 
 	// set op as contoller
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
 	err := ctrl.SetControllerReference(clientResource, obj, r.Scheme)
 	if err != nil {
+		err = fmt.Errorf("cannot set owner of %s %s. %v", kind, obj.GetName(), err)
+		r.reconcileFailed(clientResource, condType, err)
 		return err
 	}
 
-	// let's try to create / update
+	// let's try to apply
+	reason := httpapiv2.ReasonUpdated
 	if isNew {
-		log.Info(fmt.Sprintf("Create new object: %v", obj.GetName()))
-		err = r.Create(context.TODO(), obj)
-	} else {
-		log.Info(fmt.Sprintf("Update object: %v", obj.GetName()))
-		err = r.Update(context.TODO(), obj)
+		reason = httpapiv2.ReasonCreated
 	}
+	log.Info(fmt.Sprintf("Apply object: %v", obj.GetName()))
+	err = r.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
 	if err != nil {
-		return fmt.Errorf("object (%s) has not been created. %v", obj.GetName(), err)
+		err = fmt.Errorf("object (%s) has not been applied. %v", obj.GetName(), err)
+		r.reconcileFailed(clientResource, condType, err)
+		return err
+	}
+
+	switch {
+	case isNew:
+		r.Recorder.Eventf(clientResource, v1.EventTypeNormal, httpapiv2.ReasonCreated, "%s %s has been created", kind, obj.GetName())
+	case obj.GetResourceVersion() == live.GetResourceVersion():
+		// the object has not been changed by the apply
+	case specHasChanged:
+		r.Recorder.Eventf(clientResource, v1.EventTypeNormal, httpapiv2.ReasonUpdated, "%s %s has been updated", kind, obj.GetName())
+	default:
+		// the object has been changed by the apply without spec change: the operator-owned fields were modified
+		r.driftCorrected(ctx, clientResource, kind, obj.GetName())
 	}
 
-	*statusFlag = true
+	setCondition(clientResource, condType, metav1.ConditionTrue, reason, fmt.Sprintf("%s has been %s", obj.GetName(), strings.ToLower(reason)))
 	err = r.Status().Update(context.TODO(), clientResource)
 
 	if err != nil {
@@ -279,12 +651,110 @@ func (r *EasyHttpReconciler) createOrUpdate(ctx context.Context, req ctrl.Reques
 	return nil
 }
 
+// ensure reads the live state of desired into live and applies desired when it is new, the spec has changed or inSync
+// reports that the operator-owned fields of live differ from the desired ones. It returns true if desired has been applied.
+func (r *EasyHttpReconciler) ensure(ctx context.Context, req ctrl.Request, desired, live client.Object, inSync func() bool,
+	clientResource *httpapiv2.EasyHttp, condType string, specHasChanged bool) (bool, error) {
+	kind := desired.GetObjectKind().GroupVersionKind().Kind
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(desired), live)
+	isNew := false
+	if err != nil && errors.IsNotFound(err) {
+		isNew = true
+	} else if err != nil {
+		err = fmt.Errorf("cannot get %s %s, retying later. %v", kind, desired.GetName(), err)
+		r.reconcileFailed(clientResource, condType, err)
+		return false, err
+	}
+	if !isNew && !specHasChanged && inSync() {
+		return false, nil
+	}
+	if err = r.apply(ctx, req, desired, live, clientResource, condType, isNew, specHasChanged); err != nil {
+		return false, err
+	}
+	log.FromContext(ctx).Info(fmt.Sprintf("%s %s has been successfuly applied :)", kind, desired.GetName()))
+	return true, nil
+}
+
+// removeOwned reads obj by its name and deletes it when it is controlled by clientResource
+func (r *EasyHttpReconciler) removeOwned(ctx context.Context, obj client.Object, kind string, clientResource *httpapiv2.EasyHttp, condType string) error {
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+	// there is nothing to remove when the kind is not installed in the cluster (e.g. the Traefik middlewares)
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil
+	} else if err != nil {
+		err = fmt.Errorf("cannot get %s %s, retying later. %v", kind, obj.GetName(), err)
+		r.reconcileFailed(clientResource, condType, err)
+		return err
+	}
+	return r.deleteOwned(ctx, obj, kind, clientResource, condType)
+}
+
+// deleteOwned deletes the live obj of kind when it is controlled by clientResource, the objects created by someone else
+// are left untouched. The condType condition of clientResource is set to false and an event is emitted when it fails.
+func (r *EasyHttpReconciler) deleteOwned(ctx context.Context, obj client.Object, kind string, clientResource *httpapiv2.EasyHttp, condType string) error {
+	if !metav1.IsControlledBy(obj, clientResource) {
+		return nil
+	}
+	if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+		err = fmt.Errorf("cannot delete %s %s. %v", kind, obj.GetName(), err)
+		r.reconcileFailed(clientResource, condType, err)
+		return err
+	}
+	log.FromContext(ctx).Info(fmt.Sprintf("%s %v has been deleted", kind, obj.GetName()))
+	r.Recorder.Eventf(clientResource, v1.EventTypeNormal, httpapiv2.ReasonDeleted, "%s %s has been deleted", kind, obj.GetName())
+	return nil
+}
+
+// driftCorrected reports that the operator-owned fields of an object were modified outside of the operator and have been restored
+func (r *EasyHttpReconciler) driftCorrected(ctx context.Context, clientResource *httpapiv2.EasyHttp, kind, name string) {
+	log.FromContext(ctx).Info(fmt.Sprintf("%s %s has been modified outside of the operator, restored", kind, name))
+	r.Recorder.Eventf(clientResource, v1.EventTypeWarning, httpapiv2.ReasonDriftCorrected,
+		"%s %s has been modified outside of the operator, operator-owned fields have been restored", kind, name)
+}
+
+// reconcileFailed sets the condType condition of clientResource to false and emits a warning event with err
+func (r *EasyHttpReconciler) reconcileFailed(clientResource *httpapiv2.EasyHttp, condType string, err error) {
+	setCondition(clientResource, condType, metav1.ConditionFalse, httpapiv2.ReasonReconcileFailed, err.Error())
+	r.Recorder.Event(clientResource, v1.EventTypeWarning, httpapiv2.ReasonReconcileFailed, err.Error())
+}
+
 // SetupWithManager sets up the controller with the Manager.
+// Status-only updates of EasyHttp do not trigger reconcile, the changes of its annotations (actions), of owned resources
+// and of the referenced ConfigMaps and Secrets do.
 func (r *EasyHttpReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&httpapiv1.EasyHttp{}).
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &httpapiv2.EasyHttp{}, indexConfigMapRefs, indexConfigMapRefsFunc); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &httpapiv2.EasyHttp{}, indexSecretRefs, indexSecretRefsFunc); err != nil {
+		return err
+	}
+	bld := ctrl.NewControllerManagedBy(mgr).
+		For(&httpapiv2.EasyHttp{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
 		Owns(&appsv1.Deployment{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
 		Owns(&v1.Service{}).
 		Owns(&netv1.Ingress{}).
-		Complete(r)
+		// only the metadata of the ConfigMaps and Secrets is cached, the referenced ones are read directly (see ConfigMapsAndSecretsUncached)
+		Watches(&source.Kind{Type: &v1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.requestsForConfigMap),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}), builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &v1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.requestsForSecret),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}), builder.OnlyMetadata)
+	// the Traefik middlewares are watched only when their CRD is installed, the operator runs without Traefik
+	_, err := mgr.GetRESTMapper().RESTMapping(traefikMiddlewareGVK.GroupKind(), traefikMiddlewareGVK.Version)
+	if err == nil {
+		return bld.Owns(middlewareKind()).Complete(r)
+	}
+	if !meta.IsNoMatchError(err) {
+		return err
+	}
+	mgr.GetLogger().Info("Traefik middlewares are not installed, they are watched once their CRD is installed")
+	c, err := bld.Build(r)
+	if err != nil {
+		return err
+	}
+	return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return watchMiddlewares(log.IntoContext(ctx, mgr.GetLogger()), mgr.GetRESTMapper(), c)
+	}))
 }
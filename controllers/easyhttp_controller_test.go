@@ -2,18 +2,25 @@ package controllers
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
-	httpapiv1 "github.com/akosbalogh005/easyhttp-operator/api/v1"
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/akosbalogh005/easyhttp-operator/controllers/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var clientMock = mocks.ReconcilerClientIF{}
@@ -21,8 +28,10 @@ var subResourceWriterMock = mocks.SubResourceWriterIF{}
 
 func setup(t *testing.T) (*EasyHttpReconciler, *ctrl.Request) {
 	reconciler := &EasyHttpReconciler{
-		Client: &clientMock,
-		Scheme: newTestScheme(),
+		Client:      &clientMock,
+		Scheme:      newTestScheme(),
+		Recorder:    record.NewFakeRecorder(100),
+		SizePresets: DefaultSizePresets(),
 	}
 	req := ctrl.Request{}
 	req.Namespace = "namespace1"
@@ -33,69 +42,156 @@ func setup(t *testing.T) (*EasyHttpReconciler, *ctrl.Request) {
 
 func newTestScheme() *runtime.Scheme {
 	testScheme := runtime.NewScheme()
-	_ = httpapiv1.AddToScheme(testScheme)
+	_ = httpapiv2.AddToScheme(testScheme)
 	_ = appsv1.AddToScheme(testScheme)
 	return testScheme
 }
 
+// newTestResource returns the application used by the tests, which adjust it to the case they check
+func newTestResource() *httpapiv2.EasyHttp {
+	var replicas int32 = 2
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Name = "app1"
+	clientResource.Namespace = "namespace1"
+	clientResource.UID = "uid1"
+	clientResource.Spec = httpapiv2.EasyHttpSpec{
+		Host:      "testhost",
+		Container: httpapiv2.ContainerSpec{Image: "testimage", Tag: "1.0", Port: 1234},
+		Routes:    []httpapiv2.RouteSpec{{Path: "/app"}},
+		Scaling:   httpapiv2.ScalingSpec{Replicas: &replicas},
+	}
+	return &clientResource
+}
+
 // TestDeploymentNew positive test for creating new deployment. No reconfigure. Totally new
 func TestDeploymentNewOK(t *testing.T) {
 
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsDeployOK: false,
-		},
+		Status: httpapiv2.EasyHttpStatus{},
 	}
 
 	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
 	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
 
-	newDep := initDeployment(&clientResource)
+	newDep := initDeployment(&clientResource, deploymentParams{})
 	err := ctrl.SetControllerReference(&clientResource, newDep, reconciler.Scheme)
 	assert.NoError(t, err)
 
-	clientMock.On("Create", mock.Anything, newDep).Return(nil).Once()
+	clientMock.On("Patch", mock.Anything, newDep, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Once()
 	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
 	defer clientMock.AssertExpectations(t)
 
 	res, err := reconciler.CheckDeployment(ctx, *req, false, &clientResource)
 
 	assert.NoError(t, err)
-	assert.Equal(t, ctrl.Result{}, res)
+	// the new deployment has not been rolled out yet
+	assert.Equal(t, ctrl.Result{RequeueAfter: rolloutRequeueDelay}, res)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionDeploymentReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, httpapiv2.ReasonRolloutInProgress, cond.Reason)
+	assert.Equal(t, int32(1), clientResource.Status.DesiredReplicas)
+	assertEvent(t, reconciler, httpapiv2.ReasonCreated)
+}
+
+// TestDeploymentGetFailed negative test for a failing get of the deployment
+func TestDeploymentGetFailed(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{
+		Status: httpapiv2.EasyHttpStatus{},
+	}
+
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(errors.NewServiceUnavailable("boom")).Once()
+	defer clientMock.AssertExpectations(t)
+
+	res, err := reconciler.CheckDeployment(ctx, *req, false, &clientResource)
+
+	assert.Error(t, err)
+	assert.Equal(t, ctrl.Result{Requeue: true}, res)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionDeploymentReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, httpapiv2.ReasonReconcileFailed, cond.Reason)
+	assertEvent(t, reconciler, "Warning "+httpapiv2.ReasonReconcileFailed)
 }
 
-// TestDeploymentUpdateOK positive test for update deployment. Reconfigure
+// TestDeploymentUpdateOK positive test for update deployment. The live deployment has been modified manually
 func TestDeploymentUpdateOK(t *testing.T) {
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsDeployOK: false,
-		},
+		Status: httpapiv2.EasyHttpStatus{},
 	}
 
 	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
 
-	// Get: found
-	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	// Get: found, modified
+	liveDep := initDeployment(&clientResource, deploymentParams{})
+	liveDep.ResourceVersion = "1"
+	liveDep.Spec.Template.Spec.Containers[0].Image = "manual:edit"
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(getReturns(liveDep)).Once()
 
-	newDep := initDeployment(&clientResource)
+	newDep := initDeployment(&clientResource, deploymentParams{})
 	err := ctrl.SetControllerReference(&clientResource, newDep, reconciler.Scheme)
 	assert.NoError(t, err)
 
-	clientMock.On("Update", mock.Anything, newDep).Return(nil).Once()
+	// the apply restores the image
+	clientMock.On("Patch", mock.Anything, newDep, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(client.Object).SetResourceVersion("2")
+	}).Once()
 	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
 	defer clientMock.AssertExpectations(t)
 
 	_, err = reconciler.CheckDeployment(ctx, *req, false, &clientResource)
 
 	assert.NoError(t, err)
+	assertEvent(t, reconciler, httpapiv2.ReasonDriftCorrected)
+}
+
+// TestDeploymentAutoscalingOnOK positive test for turning autoscaling on: the live replicas are handed over before the
+// operator stops applying them
+func TestDeploymentAutoscalingOnOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := newTestResource()
+	liveDep := initDeployment(clientResource, deploymentParams{})
+	*liveDep.Spec.Replicas = 4
+	liveDep.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: fieldManager, Operation: metav1.ManagedFieldsOperationApply,
+		FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{},"f:template":{}}}`)}}}
+	clientResource.Spec.Scaling.Autoscaling = &httpapiv2.AutoscalingSpec{MaxReplicas: 5}
+
+	var handover *unstructured.Unstructured
+	var applied *appsv1.Deployment
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Run(getReturns(liveDep)).Once()
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*unstructured.Unstructured"), client.Apply, client.FieldOwner(handoverFieldManager)).Return(nil).Run(func(args mock.Arguments) {
+		handover = args.Get(1).(*unstructured.Unstructured)
+	}).Once()
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*v1.Deployment"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		applied = args.Get(1).(*appsv1.Deployment)
+	}).Once()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+	defer subResourceWriterMock.AssertExpectations(t)
+	defer clientMock.AssertExpectations(t)
+
+	_, err := reconciler.CheckDeployment(ctx, *req, true, clientResource)
+
+	assert.NoError(t, err)
+	replicas, _, _ := unstructured.NestedInt64(handover.Object, "spec", "replicas")
+	assert.Equal(t, int64(4), replicas)
+	assert.Nil(t, applied.Spec.Replicas)
+
+	// the replicas are not handed over again when the operator does not own them anymore
+	liveDep.ManagedFields[0].FieldsV1.Raw = []byte(`{"f:spec":{"f:template":{}}}`)
+	assert.False(t, replicasApplied(liveDep))
 }
 
 // TestDeploymentAlreadyDeployedOK positive test for already deployed and nothing changed
@@ -103,20 +199,210 @@ func TestDeploymentAlreadyDeployedOK(t *testing.T) {
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsDeployOK: true,
+		Status: httpapiv2.EasyHttpStatus{
+			Conditions: []metav1.Condition{{Type: httpapiv2.ConditionDeploymentReady, Status: metav1.ConditionTrue}},
 		},
 	}
 
 	// Get: found
-	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(getReturns(initDeployment(&clientResource, deploymentParams{}))).Once()
+	defer clientMock.AssertExpectations(t)
+
+	_, err := reconciler.CheckDeployment(ctx, *req, false, &clientResource)
+
+	assert.NoError(t, err)
+}
+
+// TestDeploymentConfigChangedOK positive test for a change of a referenced ConfigMap. The pods are rolled
+func TestDeploymentConfigChangedOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Spec.Container.EnvFrom = []corev1.EnvFromSource{
+		{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}},
+	}
+
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+
+	// Get: the configmap has been changed since the live deployment was applied
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.ConfigMap")).Return(nil).
+		Run(getReturns(&corev1.ConfigMap{Data: map[string]string{"mode": "dev"}})).Once()
+	liveDep := initDeployment(&clientResource, deploymentParams{configChecksum: "old"})
+	liveDep.ResourceVersion = "1"
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Run(getReturns(liveDep)).Once()
+
+	var applied *appsv1.Deployment
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*v1.Deployment"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		applied = args.Get(1).(*appsv1.Deployment)
+		applied.SetResourceVersion("2")
+	}).Once()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
 	defer clientMock.AssertExpectations(t)
 
 	_, err := reconciler.CheckDeployment(ctx, *req, false, &clientResource)
 
 	assert.NoError(t, err)
+	assert.NotNil(t, applied)
+	assert.NotEqual(t, "old", applied.Spec.Template.Annotations[annotationConfigChecksum])
+	assert.NotEmpty(t, applied.Spec.Template.Annotations[annotationConfigChecksum])
+	assertEvent(t, reconciler, httpapiv2.ReasonConfigChanged)
+	assertEvent(t, reconciler, "Normal "+httpapiv2.ReasonUpdated)
+}
+
+// TestDeploymentUnknownPresetFailed negative test for a size preset not configured in the operator
+func TestDeploymentUnknownPresetFailed(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Spec.Resources.Preset = "huge"
+	defer clientMock.AssertExpectations(t)
+
+	res, err := reconciler.CheckDeployment(ctx, *req, false, &clientResource)
+
+	assert.Error(t, err)
+	assert.Equal(t, ctrl.Result{Requeue: true}, res)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionDeploymentReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, httpapiv2.ReasonReconcileFailed, cond.Reason)
+	assertEvent(t, reconciler, "Warning "+httpapiv2.ReasonReconcileFailed)
+}
+
+// TestAutoscalerNewOK positive test for creating new autoscaler when autoscaling is on
+func TestAutoscalerNewOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Spec.Scaling.Autoscaling = &httpapiv2.AutoscalingSpec{MaxReplicas: 5}
+
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v2.HorizontalPodAutoscaler")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+
+	newHpa := initHorizontalPodAutoscaler(&clientResource)
+	err := ctrl.SetControllerReference(&clientResource, newHpa, reconciler.Scheme)
+	assert.NoError(t, err)
+
+	clientMock.On("Patch", mock.Anything, newHpa, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Once()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
+	defer clientMock.AssertExpectations(t)
+
+	res, err := reconciler.CheckAutoscaler(ctx, *req, false, &clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, res)
+	assert.True(t, isConditionTrue(&clientResource, httpapiv2.ConditionAutoscalerReady))
+	assertEvent(t, reconciler, httpapiv2.ReasonCreated)
+}
+
+// TestAutoscalerOffOK positive test for autoscaling off without autoscaler
+func TestAutoscalerOffOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{}
+
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v2.HorizontalPodAutoscaler")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	defer clientMock.AssertExpectations(t)
+
+	res, err := reconciler.CheckAutoscaler(ctx, *req, false, &clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, res)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionAutoscalerReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, httpapiv2.ReasonAutoscalerOff, cond.Reason)
+}
+
+// TestAutoscalerOffDeleteOK positive test for turning autoscaling off. The autoscaler of the operator is deleted
+func TestAutoscalerOffDeleteOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Name = "app1"
+	clientResource.UID = "uid1"
+	clientResource.Spec.Scaling.Autoscaling = &httpapiv2.AutoscalingSpec{MaxReplicas: 5}
+	liveHpa := initHorizontalPodAutoscaler(&clientResource)
+	err := ctrl.SetControllerReference(&clientResource, liveHpa, reconciler.Scheme)
+	assert.NoError(t, err)
+	clientResource.Spec.Scaling.Autoscaling = nil
+
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v2.HorizontalPodAutoscaler")).Return(nil).Run(getReturns(liveHpa)).Once()
+	clientMock.On("Delete", mock.Anything, mock.AnythingOfType("*v2.HorizontalPodAutoscaler")).Return(nil).Once()
+	defer clientMock.AssertExpectations(t)
+
+	_, err = reconciler.CheckAutoscaler(ctx, *req, false, &clientResource)
+
+	assert.NoError(t, err)
+	assert.True(t, isConditionTrue(&clientResource, httpapiv2.ConditionAutoscalerReady))
+	assertEvent(t, reconciler, httpapiv2.ReasonDeleted)
+}
+
+// TestDisruptionBudgetNewOK positive test for creating new disruption budget for multiple replicas
+func TestDisruptionBudgetNewOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	var replicas int32 = 3
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Spec.Scaling.Replicas = &replicas
+
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.PodDisruptionBudget")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+
+	newPdb := initPodDisruptionBudget(&clientResource)
+	err := ctrl.SetControllerReference(&clientResource, newPdb, reconciler.Scheme)
+	assert.NoError(t, err)
+
+	clientMock.On("Patch", mock.Anything, newPdb, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Once()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
+	defer clientMock.AssertExpectations(t)
+
+	_, err = reconciler.CheckDisruptionBudget(ctx, *req, false, &clientResource)
+
+	assert.NoError(t, err)
+	assert.True(t, isConditionTrue(&clientResource, httpapiv2.ConditionDisruptionBudgetReady))
+	assertEvent(t, reconciler, httpapiv2.ReasonCreated)
+}
+
+// TestDisruptionBudgetNotRequiredOK positive test for scaling down to one replica. Only the budget of the operator is deleted
+func TestDisruptionBudgetNotRequiredOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Name = "app1"
+	clientResource.UID = "uid1"
+	ownedPdb := initPodDisruptionBudget(&clientResource)
+	err := ctrl.SetControllerReference(&clientResource, ownedPdb, reconciler.Scheme)
+	assert.NoError(t, err)
+
+	// owned: deleted
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.PodDisruptionBudget")).Return(nil).Run(getReturns(ownedPdb)).Once()
+	clientMock.On("Delete", mock.Anything, mock.AnythingOfType("*v1.PodDisruptionBudget")).Return(nil).Once()
+	defer clientMock.AssertExpectations(t)
+
+	_, err = reconciler.CheckDisruptionBudget(ctx, *req, false, &clientResource)
+
+	assert.NoError(t, err)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionDisruptionBudgetReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, httpapiv2.ReasonNotRequired, cond.Reason)
+	assertEvent(t, reconciler, httpapiv2.ReasonDeleted)
+
+	// created by someone else: kept
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.PodDisruptionBudget")).Return(nil).Run(getReturns(initPodDisruptionBudget(&clientResource))).Once()
+
+	_, err = reconciler.CheckDisruptionBudget(ctx, *req, false, &clientResource)
+
+	assert.NoError(t, err)
+	assert.True(t, isConditionTrue(&clientResource, httpapiv2.ConditionDisruptionBudgetReady))
 }
 
 // TestServiveNewOK positive test for creating new service. No reconfigure. Totally new
@@ -125,11 +411,9 @@ func TestServiveNewOK(t *testing.T) {
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsSvcOK: false,
-		},
+		Status: httpapiv2.EasyHttpStatus{},
 	}
 
 	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
@@ -141,7 +425,7 @@ func TestServiveNewOK(t *testing.T) {
 	err := ctrl.SetControllerReference(&clientResource, newServ, reconciler.Scheme)
 	assert.NoError(t, err)
 
-	clientMock.On("Create", mock.Anything, newServ).Return(nil).Once()
+	clientMock.On("Patch", mock.Anything, newServ, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Once()
 	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
 
 	res, serv, err := reconciler.CheckService(ctx, *req, false, &clientResource)
@@ -149,39 +433,44 @@ func TestServiveNewOK(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, newServ, serv)
 	assert.Equal(t, ctrl.Result{}, res)
-
+	assertEvent(t, reconciler, httpapiv2.ReasonCreated)
 }
 
-// TestServiceUpdateOK positive test for update service. Reconfigure
+// TestServiceUpdateOK positive test for update service. The live service has been modified manually
 func TestServiceUpdateOK(t *testing.T) {
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsSvcOK: false,
-		},
+		Status: httpapiv2.EasyHttpStatus{},
 	}
 
 	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
 
-	// Get: found
-	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	// Get: found, modified
+	liveServ := initService(&clientResource)
+	liveServ.ResourceVersion = "1"
+	liveServ.Spec.Ports[0].Port = 9999
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(getReturns(liveServ)).Once()
 	defer clientMock.AssertExpectations(t)
 
 	newServ := initService(&clientResource)
 	err := ctrl.SetControllerReference(&clientResource, newServ, reconciler.Scheme)
 	assert.NoError(t, err)
 
-	clientMock.On("Update", mock.Anything, newServ).Return(nil).Once()
+	clientMock.On("Patch", mock.Anything, newServ, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(client.Object).SetResourceVersion("2")
+	}).Once()
 	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
 
 	res, serv, err := reconciler.CheckService(ctx, *req, false, &clientResource)
 
 	assert.NoError(t, err)
+	newServ.ResourceVersion = "2"
 	assert.Equal(t, newServ, serv)
 	assert.Equal(t, ctrl.Result{}, res)
+	assertEvent(t, reconciler, httpapiv2.ReasonDriftCorrected)
 }
 
 // TestServiceAlreadyDeployedOK positive test for already deployed and nothing changed
@@ -189,16 +478,16 @@ func TestServiceAlreadyDeployedOK(t *testing.T) {
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsSvcOK: true,
+		Status: httpapiv2.EasyHttpStatus{
+			Conditions: []metav1.Condition{{Type: httpapiv2.ConditionServiceReady, Status: metav1.ConditionTrue}},
 		},
 	}
 
 	newServ := initService(&clientResource)
 	// Get: found
-	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(getReturns(newServ)).Once()
 	defer clientMock.AssertExpectations(t)
 
 	res, serv, err := reconciler.CheckService(ctx, *req, false, &clientResource)
@@ -214,15 +503,17 @@ func TestIngressNewOK(t *testing.T) {
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsIngressOK: false,
-		},
+		Status: httpapiv2.EasyHttpStatus{},
 	}
 
 	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+	// the Traefik middlewares are not installed
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(&meta.NoKindMatchError{}).Once()
 	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	// there are no rewrite and redirect ingresses
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Ingress")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Twice()
 	defer subResourceWriterMock.AssertExpectations(t)
 	defer clientMock.AssertExpectations(t)
 
@@ -231,32 +522,38 @@ func TestIngressNewOK(t *testing.T) {
 	err := ctrl.SetControllerReference(&clientResource, newIng, reconciler.Scheme)
 	assert.NoError(t, err)
 
-	clientMock.On("Create", mock.Anything, newIng).Return(nil).Once()
+	clientMock.On("Patch", mock.Anything, newIng, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Once()
 	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
 
 	res, err := reconciler.CheckIngress(ctx, *req, false, &clientResource, newServ)
 
 	assert.NoError(t, err)
 	assert.Equal(t, ctrl.Result{}, res)
-
+	assertEvent(t, reconciler, httpapiv2.ReasonCreated)
 }
 
-// TestIngressUpdateOK positive test for update ingress. Reconfigure
+// TestIngressUpdateOK positive test for update ingress. The spec has changed
 func TestIngressUpdateOK(t *testing.T) {
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsIngressOK: false,
-		},
+		Status: httpapiv2.EasyHttpStatus{},
 	}
 
 	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
 	defer subResourceWriterMock.AssertExpectations(t)
-	// Get: found
-	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	// Get: found, modified
+	liveIng := initIngress(&clientResource, clientResource.Name+"-svc")
+	liveIng.ResourceVersion = "1"
+	liveIng.Spec.Rules[0].Host = "old.host"
+	liveIng.Annotations = map[string]string{"foreign": "value", annotationNginxRewriteTarget: "/$2"}
+	// there is no middleware
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(getReturns(liveIng)).Once()
+	// there are no rewrite and redirect ingresses
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Ingress")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Twice()
 	defer clientMock.AssertExpectations(t)
 
 	newServ := initService(&clientResource)
@@ -264,13 +561,18 @@ func TestIngressUpdateOK(t *testing.T) {
 	err := ctrl.SetControllerReference(&clientResource, newIng, reconciler.Scheme)
 	assert.NoError(t, err)
 
-	clientMock.On("Update", mock.Anything, newIng).Return(nil).Once()
+	clientMock.On("Patch", mock.Anything, newIng, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(client.Object).SetResourceVersion("2")
+	}).Once()
 	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
 
-	res, err := reconciler.CheckIngress(ctx, *req, false, &clientResource, newServ)
+	res, err := reconciler.CheckIngress(ctx, *req, true, &clientResource, newServ)
 
 	assert.NoError(t, err)
 	assert.Equal(t, ctrl.Result{}, res)
+	// spec change is not a drift
+	assertEvent(t, reconciler, "Normal "+httpapiv2.ReasonUpdated)
+	assert.Empty(t, reconciler.Recorder.(*record.FakeRecorder).Events)
 }
 
 // TestIngressAlreadyDeployedOK positive test for already existed ingress. Nothing changed
@@ -278,15 +580,19 @@ func TestIngressAlreadyDeployedOK(t *testing.T) {
 	reconciler, req := setup(t)
 	ctx := context.Background()
 
-	clientResource := httpapiv1.EasyHttp{
+	clientResource := httpapiv2.EasyHttp{
 		//TypeMeta: metav1.TypeMeta{Kind: "EasyHttp"},
-		Status: httpapiv1.EasyHttpStatus{
-			IsIngressOK: true,
+		Status: httpapiv2.EasyHttpStatus{
+			Conditions: []metav1.Condition{{Type: httpapiv2.ConditionIngressReady, Status: metav1.ConditionTrue}},
 		},
 	}
 
 	newServ := initService(&clientResource)
-	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	// there is no middleware
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(getReturns(initIngress(&clientResource, newServ.Name))).Once()
+	// there are no rewrite and redirect ingresses
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Ingress")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Twice()
 	defer clientMock.AssertExpectations(t)
 
 	res, err := reconciler.CheckIngress(ctx, *req, false, &clientResource, newServ)
@@ -294,3 +600,99 @@ func TestIngressAlreadyDeployedOK(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, ctrl.Result{}, res)
 }
+
+// TestCertificateDisabledOK positive test for disabled cert manager
+func TestCertificateDisabledOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{}
+
+	res, err := reconciler.CheckCertificate(ctx, *req, &clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, res)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionCertificateReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, httpapiv2.ReasonCertDisabled, cond.Reason)
+}
+
+// TestCertificatePendingOK positive test for not yet issued certificate secret
+func TestCertificatePendingOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{
+		Spec: httpapiv2.EasyHttpSpec{Host: "example.net", TLS: httpapiv2.TLSSpec{Issuer: "local.issuer"}},
+	}
+
+	clientMock.On("Get", mock.Anything, client.ObjectKey{Name: "example-net-tls"}, mock.Anything).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	defer clientMock.AssertExpectations(t)
+
+	res, err := reconciler.CheckCertificate(ctx, *req, &clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: certificateRequeueDelay}, res)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionCertificateReady)
+	assert.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, httpapiv2.ReasonCertPending, cond.Reason)
+}
+
+// TestCertificateIssuedOK positive test for issued certificate secret
+func TestCertificateIssuedOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := httpapiv2.EasyHttp{
+		Spec: httpapiv2.EasyHttpSpec{Host: "example.net", TLS: httpapiv2.TLSSpec{Issuer: "local.issuer"}},
+	}
+
+	clientMock.On("Get", mock.Anything, client.ObjectKey{Name: "example-net-tls"}, mock.Anything).Return(nil).Once()
+	defer clientMock.AssertExpectations(t)
+
+	res, err := reconciler.CheckCertificate(ctx, *req, &clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, res)
+	assert.True(t, isConditionTrue(&clientResource, httpapiv2.ConditionCertificateReady))
+}
+
+// TestUpdateReadyCondition checks the aggregation of resource conditions into the Ready condition
+func TestUpdateReadyCondition(t *testing.T) {
+	clientResource := httpapiv2.EasyHttp{}
+
+	updateReadyCondition(&clientResource)
+	assert.False(t, isConditionTrue(&clientResource, httpapiv2.ConditionReady))
+
+	for _, condType := range resourceConditions {
+		setCondition(&clientResource, condType, metav1.ConditionTrue, httpapiv2.ReasonCreated, "")
+	}
+	updateReadyCondition(&clientResource)
+	assert.True(t, isConditionTrue(&clientResource, httpapiv2.ConditionReady))
+
+	setCondition(&clientResource, httpapiv2.ConditionIngressReady, metav1.ConditionFalse, httpapiv2.ReasonReconcileFailed, "boom")
+	updateReadyCondition(&clientResource)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionReady)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, httpapiv2.ReasonResourcesNotReady, cond.Reason)
+	assert.Equal(t, "IngressReady: boom", cond.Message)
+}
+
+// getReturns makes the mocked Get fill the requested object with a copy of obj
+func getReturns(obj client.Object) func(args mock.Arguments) {
+	return func(args mock.Arguments) {
+		reflect.ValueOf(args.Get(2)).Elem().Set(reflect.ValueOf(obj.DeepCopyObject()).Elem())
+	}
+}
+
+// assertEvent checks if the next recorded event has the given reason
+func assertEvent(t *testing.T, reconciler *EasyHttpReconciler, reason string) {
+	select {
+	case event := <-reconciler.Recorder.(*record.FakeRecorder).Events:
+		assert.Contains(t, event, reason)
+	default:
+		assert.Fail(t, "no event has been recorded", reason)
+	}
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// the probes generated from the health path shortcut, the liveness probe starts later and checks less often
+// than the readiness probe, so a slow application is taken out of the traffic before it is restarted
+var (
+	healthPathReadiness = httpapiv2.Probe{InitialDelaySeconds: 5, TimeoutSeconds: 1, PeriodSeconds: 10, FailureThreshold: 3}
+	healthPathLiveness  = httpapiv2.Probe{InitialDelaySeconds: 15, TimeoutSeconds: 1, PeriodSeconds: 20, FailureThreshold: 3}
+)
+
+// initProbes creates the liveness, readiness and startup probes of the application container based on clientResource
+func initProbes(clientResource *httpapiv2.EasyHttp) (liveness, readiness, startup *corev1.Probe) {
+	probes := clientResource.Spec.Probes
+	port := clientResource.Spec.Container.Port
+
+	livenessSpec, readinessSpec := probes.Liveness, probes.Readiness
+	if probes.HealthPath != "" {
+		if livenessSpec == nil {
+			livenessSpec = healthPathLiveness.DeepCopy()
+			livenessSpec.HTTPGet = &httpapiv2.HTTPGetProbe{Path: probes.HealthPath}
+		}
+		if readinessSpec == nil {
+			readinessSpec = healthPathReadiness.DeepCopy()
+			readinessSpec.HTTPGet = &httpapiv2.HTTPGetProbe{Path: probes.HealthPath}
+		}
+	}
+	return convertProbe(livenessSpec, port), convertProbe(readinessSpec, port), convertProbe(probes.Startup, port)
+}
+
+// convertProbe converts probe into a container probe, the checks without port use appPort. It returns nil when probe is nil.
+func convertProbe(probe *httpapiv2.Probe, appPort int32) *corev1.Probe {
+	if probe == nil {
+		return nil
+	}
+	ret := &corev1.Probe{
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		TimeoutSeconds:      probe.TimeoutSeconds,
+		PeriodSeconds:       probe.PeriodSeconds,
+		SuccessThreshold:    probe.SuccessThreshold,
+		FailureThreshold:    probe.FailureThreshold,
+	}
+	switch {
+	case probe.HTTPGet != nil:
+		// the route path is rewritten to the root of the container, so the root is checked by default
+		path := probe.HTTPGet.Path
+		if path == "" {
+			path = httpapiv2.DefaultPath
+		}
+		ret.HTTPGet = &corev1.HTTPGetAction{Path: path, Port: probePort(probe.HTTPGet.Port, appPort)}
+	case probe.TCPSocket != nil:
+		ret.TCPSocket = &corev1.TCPSocketAction{Port: probePort(probe.TCPSocket.Port, appPort)}
+	case probe.Exec != nil:
+		ret.Exec = &corev1.ExecAction{Command: append([]string(nil), probe.Exec.Command...)}
+	}
+	return ret
+}
+
+// probePort returns port of a check, appPort when it is not set
+func probePort(port, appPort int32) intstr.IntOrString {
+	if port == 0 {
+		port = appPort
+	}
+	return intstr.FromInt(int(port))
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestInitProbes(t *testing.T) {
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Spec.Container.Port = 1234
+
+	tests := map[string]struct {
+		probes                       httpapiv2.ProbesSpec
+		liveness, readiness, startup *corev1.Probe
+	}{
+		"no probes": {},
+		"health path": {
+			probes: httpapiv2.ProbesSpec{HealthPath: "/healthz"},
+			liveness: &corev1.Probe{
+				ProbeHandler:        corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(1234)}},
+				InitialDelaySeconds: 15, TimeoutSeconds: 1, PeriodSeconds: 20, FailureThreshold: 3,
+			},
+			readiness: &corev1.Probe{
+				ProbeHandler:        corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(1234)}},
+				InitialDelaySeconds: 5, TimeoutSeconds: 1, PeriodSeconds: 10, FailureThreshold: 3,
+			},
+		},
+		"explicit probes override health path": {
+			probes: httpapiv2.ProbesSpec{
+				HealthPath: "/healthz",
+				Liveness:   &httpapiv2.Probe{TCPSocket: &httpapiv2.TCPSocketProbe{}, PeriodSeconds: 30},
+				Readiness:  &httpapiv2.Probe{HTTPGet: &httpapiv2.HTTPGetProbe{Port: 9090}, SuccessThreshold: 2},
+				Startup:    &httpapiv2.Probe{Exec: &httpapiv2.ExecProbe{Command: []string{"cat", "/tmp/started"}}, FailureThreshold: 30},
+			},
+			liveness: &corev1.Probe{
+				ProbeHandler:  corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(1234)}},
+				PeriodSeconds: 30,
+			},
+			readiness: &corev1.Probe{
+				ProbeHandler:     corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/", Port: intstr.FromInt(9090)}},
+				SuccessThreshold: 2,
+			},
+			startup: &corev1.Probe{
+				ProbeHandler:     corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"cat", "/tmp/started"}}},
+				FailureThreshold: 30,
+			},
+		},
+	}
+
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			clientResource.Spec.Probes = v.probes
+
+			liveness, readiness, startup := initProbes(&clientResource)
+
+			assert.Equal(t, v.liveness, liveness)
+			assert.Equal(t, v.readiness, readiness)
+			assert.Equal(t, v.startup, startup)
+		})
+	}
+}
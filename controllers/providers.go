@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// annotations of the ingress rewriting the paths with Traefik and HAProxy
+const (
+	annotationTraefikMiddlewares = "traefik.ingress.kubernetes.io/router.middlewares"
+	annotationHAProxyPathRewrite = "haproxy.org/path-rewrite"
+)
+
+// traefikMiddlewareGVK is the kind of the Traefik middleware stripping the paths of the rewritten routes
+var traefikMiddlewareGVK = schema.GroupVersionKind{Group: "traefik.io", Version: "v1alpha1", Kind: "Middleware"}
+
+// middlewareWatchRetryDelay is the delay between the checks of the Middleware CRD when it was not installed at the start
+// of the operator
+const middlewareWatchRetryDelay = time.Minute
+
+// IngressProvider renders the parts of the ingress of an application which depend on the ingress controller: how the
+// paths of the rewritten routes are removed from the requests. The redirect and the canary ingresses are ingress-nginx ones,
+// the webhook rejects them with the other providers.
+type IngressProvider interface {
+	// Annotations returns the annotations of the ingress of clientResource rewriting its routes, nil when there is none
+	Annotations(clientResource *httpapiv2.EasyHttp) map[string]string
+	// Path returns the path of route in the ingress of clientResource
+	Path(clientResource *httpapiv2.EasyHttp, route httpapiv2.RouteSpec) string
+	// Middleware returns the object the annotations refer to and true if it is required by the routes of clientResource.
+	// The object is nil when the provider does not need one.
+	Middleware(clientResource *httpapiv2.EasyHttp) (*unstructured.Unstructured, bool)
+	// SeparateRewrites returns true if the rewritten routes of clientResource are routed by a separate ingress holding the
+	// annotations, because they would rewrite the paths of the other routes too
+	SeparateRewrites(clientResource *httpapiv2.EasyHttp) bool
+}
+
+// ingressProviders are the providers selectable by the ingressProvider field of EasyHttp
+var ingressProviders = map[string]IngressProvider{
+	httpapiv2.IngressProviderNginx:   nginxProvider{},
+	httpapiv2.IngressProviderTraefik: traefikProvider{},
+	httpapiv2.IngressProviderHAProxy: haproxyProvider{},
+	httpapiv2.IngressProviderNone:    noRewriteProvider{},
+}
+
+// ingressProvider returns the ingress provider of clientResource, ingress-nginx when it is not set
+func ingressProvider(clientResource *httpapiv2.EasyHttp) IngressProvider {
+	if provider, ok := ingressProviders[clientResource.Spec.IngressProvider]; ok {
+		return provider
+	}
+	return nginxProvider{}
+}
+
+// rewrittenPaths returns the paths of the rewritten routes of clientResource
+func rewrittenPaths(clientResource *httpapiv2.EasyHttp) []string {
+	var paths []string
+	for _, route := range routes(clientResource) {
+		if routeRewritten(route) {
+			paths = append(paths, route.Path)
+		}
+	}
+	return paths
+}
+
+// plainPath returns the path of route, the root path when it is empty
+func plainPath(route httpapiv2.RouteSpec) string {
+	if route.Path == "" {
+		return httpapiv2.DefaultPath
+	}
+	return route.Path
+}
+
+// nginxProvider rewrites the paths with the rewrite target of ingress-nginx
+type nginxProvider struct{}
+
+func (nginxProvider) Annotations(clientResource *httpapiv2.EasyHttp) map[string]string {
+	if len(rewrittenPaths(clientResource)) == 0 {
+		return nil
+	}
+	return map[string]string{annotationNginxRewriteTarget: "/$2"}
+}
+
+// Path returns the path of route. The rewrite target of nginx applies to all the paths of the ingress, so when a route is
+// rewritten the paths are regular expressions whose second group is the rewritten path: the rest of the path for the
+// rewritten routes and the whole path for the others.
+func (nginxProvider) Path(clientResource *httpapiv2.EasyHttp, route httpapiv2.RouteSpec) string {
+	path := plainPath(route)
+	switch {
+	case len(rewrittenPaths(clientResource)) == 0 || routePathType(route) == netv1.PathTypeImplementationSpecific:
+		return path
+	case routeRewritten(route):
+		return path + "(/|$)(.*)"
+	case path == httpapiv2.DefaultPath:
+		return "/()(.*)"
+	case routePathType(route) == netv1.PathTypeExact:
+		return "/()(" + strings.TrimPrefix(path, "/") + ")$"
+	default:
+		return "/()(" + strings.TrimPrefix(path, "/") + "(?:/|$).*)"
+	}
+}
+
+func (nginxProvider) Middleware(clientResource *httpapiv2.EasyHttp) (*unstructured.Unstructured, bool) {
+	return nil, false
+}
+
+func (nginxProvider) SeparateRewrites(clientResource *httpapiv2.EasyHttp) bool {
+	return false
+}
+
+// traefikProvider strips the paths of the rewritten routes with a StripPrefixRegex middleware of Traefik. A middleware
+// applies to all the paths of the ingress, so the rewritten routes have their own ingress when there are other routes.
+type traefikProvider struct{}
+
+func (traefikProvider) Annotations(clientResource *httpapiv2.EasyHttp) map[string]string {
+	if len(rewrittenPaths(clientResource)) == 0 {
+		return nil
+	}
+	// the middleware is referenced as <namespace>-<name>@kubernetescrd
+	return map[string]string{annotationTraefikMiddlewares: fmt.Sprintf("%s-%s@kubernetescrd", clientResource.Namespace, middlewareName(clientResource))}
+}
+
+func (traefikProvider) Path(clientResource *httpapiv2.EasyHttp, route httpapiv2.RouteSpec) string {
+	return plainPath(route)
+}
+
+func (traefikProvider) Middleware(clientResource *httpapiv2.EasyHttp) (*unstructured.Unstructured, bool) {
+	paths := rewrittenPaths(clientResource)
+	// the paths are stripped up to the end of their last segment, /api is not stripped from /apiary
+	regexes := make([]interface{}, 0, len(paths))
+	for _, path := range paths {
+		regexes = append(regexes, fmt.Sprintf("^%s(/|$)", path))
+	}
+	mw := middlewareKey(clientResource)
+	mw.Object["spec"] = map[string]interface{}{"stripPrefixRegex": map[string]interface{}{"regex": regexes}}
+	return mw, len(paths) > 0
+}
+
+func (traefikProvider) SeparateRewrites(clientResource *httpapiv2.EasyHttp) bool {
+	rewritten := len(rewrittenPaths(clientResource))
+	return rewritten > 0 && rewritten < len(routes(clientResource))
+}
+
+// middlewareName returns the name of the Traefik middleware of clientResource
+func middlewareName(clientResource *httpapiv2.EasyHttp) string {
+	return clientResource.Name + "-stripprefix"
+}
+
+// middlewareKind returns an empty Traefik middleware
+func middlewareKind() *unstructured.Unstructured {
+	mw := &unstructured.Unstructured{}
+	mw.SetGroupVersionKind(traefikMiddlewareGVK)
+	return mw
+}
+
+// middlewareKey returns the Traefik middleware of clientResource without its spec
+func middlewareKey(clientResource *httpapiv2.EasyHttp) *unstructured.Unstructured {
+	mw := middlewareKind()
+	mw.SetName(middlewareName(clientResource))
+	mw.SetNamespace(clientResource.Namespace)
+	return mw
+}
+
+// haproxyProvider rewrites the paths with the path-rewrite annotation of the HAProxy ingress controller, one rule per line.
+// The rules apply to the backend of the service whatever the ingress is, so the rules skip the routes nested in the
+// rewritten ones with negative lookaheads (HAProxy is built with PCRE).
+type haproxyProvider struct{}
+
+func (haproxyProvider) Annotations(clientResource *httpapiv2.EasyHttp) map[string]string {
+	paths := rewrittenPaths(clientResource)
+	if len(paths) == 0 {
+		return nil
+	}
+	rules := make([]string, 0, len(paths))
+	for _, path := range paths {
+		rules = append(rules, fmt.Sprintf(`^%s%s(/|$)(.*) /\2`, path, nestedRoutesLookahead(clientResource, path)))
+	}
+	return map[string]string{annotationHAProxyPathRewrite: strings.Join(rules, "\n")}
+}
+
+// nestedRoutesLookahead returns the negative lookaheads of the routes of clientResource under path which are not
+// rewritten, empty when there is none
+func nestedRoutesLookahead(clientResource *httpapiv2.EasyHttp, path string) string {
+	lookahead := ""
+	for _, route := range routes(clientResource) {
+		nested := plainPath(route)
+		if routeRewritten(route) || !strings.HasPrefix(nested, path+"/") {
+			continue
+		}
+		end := "(?:/|$)"
+		if routePathType(route) == netv1.PathTypeExact {
+			end = "$"
+		}
+		lookahead += fmt.Sprintf("(?!%s%s)", strings.TrimPrefix(nested, path), end)
+	}
+	return lookahead
+}
+
+func (haproxyProvider) Path(clientResource *httpapiv2.EasyHttp, route httpapiv2.RouteSpec) string {
+	return plainPath(route)
+}
+
+func (haproxyProvider) Middleware(clientResource *httpapiv2.EasyHttp) (*unstructured.Unstructured, bool) {
+	return nil, false
+}
+
+func (haproxyProvider) SeparateRewrites(clientResource *httpapiv2.EasyHttp) bool {
+	return false
+}
+
+// noRewriteProvider routes the requests with their original paths
+type noRewriteProvider struct{}
+
+func (noRewriteProvider) Annotations(clientResource *httpapiv2.EasyHttp) map[string]string {
+	return nil
+}
+
+func (noRewriteProvider) Path(clientResource *httpapiv2.EasyHttp, route httpapiv2.RouteSpec) string {
+	return plainPath(route)
+}
+
+func (noRewriteProvider) Middleware(clientResource *httpapiv2.EasyHttp) (*unstructured.Unstructured, bool) {
+	return nil, false
+}
+
+func (noRewriteProvider) SeparateRewrites(clientResource *httpapiv2.EasyHttp) bool {
+	return false
+}
+
+// CheckMiddleware applies the middleware of the ingress provider of clientResource when its routes require one, the
+// middleware created by the operator is deleted when they do not or when the provider does not use one (e.g. it has
+// been changed from traefik)
+func (r *EasyHttpReconciler) CheckMiddleware(ctx context.Context, req ctrl.Request, specHasChanged bool, clientResource *httpapiv2.EasyHttp) error {
+	routed := routedResource(clientResource)
+	newMw, required := ingressProvider(routed).Middleware(routed)
+	if newMw == nil || !required {
+		return r.removeOwned(ctx, middlewareKey(clientResource), traefikMiddlewareGVK.Kind, clientResource, httpapiv2.ConditionIngressReady)
+	}
+	mw := &unstructured.Unstructured{}
+	mw.SetGroupVersionKind(newMw.GroupVersionKind())
+	if _, err := r.ensure(ctx, req, newMw, mw, func() bool { return middlewareInSync(newMw, mw) }, clientResource,
+		httpapiv2.ConditionIngressReady, specHasChanged); err != nil {
+		return fmt.Errorf("failed to apply middleware. %v", err)
+	}
+	return nil
+}
+
+// watchMiddlewares checks periodically whether the Middleware CRD of Traefik has been installed, then the middlewares
+// owned by the EasyHttps are watched by c. It returns when ctx is done.
+func watchMiddlewares(ctx context.Context, mapper meta.RESTMapper, c controller.Controller) error {
+	log := log.FromContext(ctx)
+	err := wait.PollImmediateUntilWithContext(ctx, middlewareWatchRetryDelay, func(ctx context.Context) (bool, error) {
+		_, err := mapper.RESTMapping(traefikMiddlewareGVK.GroupKind(), traefikMiddlewareGVK.Version)
+		if err != nil && !meta.IsNoMatchError(err) {
+			log.Error(err, "cannot check the Traefik middlewares, retrying later")
+		}
+		return err == nil, nil
+	})
+	if err != nil {
+		// the operator is stopping
+		return nil
+	}
+	log.Info("Traefik middlewares have been installed, they are watched")
+	return c.Watch(&source.Kind{Type: middlewareKind()}, &handler.EnqueueRequestForOwner{OwnerType: &httpapiv2.EasyHttp{}, IsController: true})
+}
@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// withProvider sets the ingress provider of clientResource and gives it two rewritten routes and one which is not
+func withProvider(clientResource *httpapiv2.EasyHttp, provider string) *httpapiv2.EasyHttp {
+	noRewrite := false
+	clientResource.Spec.IngressProvider = provider
+	clientResource.Spec.Routes = []httpapiv2.RouteSpec{{Path: "/api"}, {Path: "/v1/users"}, {Path: "/admin", Rewrite: &noRewrite}}
+	return clientResource
+}
+
+func TestInitIngressProviders(t *testing.T) {
+	tests := map[string]struct {
+		annotations  map[string]string
+		paths        []string
+		rewritePaths []string
+	}{
+		"": {
+			annotations: map[string]string{annotationNginxRewriteTarget: "/$2"},
+			paths:       []string{"/api(/|$)(.*)", "/v1/users(/|$)(.*)", "/()(admin(?:/|$).*)"},
+		},
+		httpapiv2.IngressProviderTraefik: {
+			paths:        []string{"/admin"},
+			rewritePaths: []string{"/api", "/v1/users"},
+		},
+		httpapiv2.IngressProviderHAProxy: {
+			annotations: map[string]string{annotationHAProxyPathRewrite: "^/api(/|$)(.*) /\\2\n^/v1/users(/|$)(.*) /\\2"},
+			paths:       []string{"/api", "/v1/users", "/admin"},
+		},
+		httpapiv2.IngressProviderNone: {
+			paths: []string{"/api", "/v1/users", "/admin"},
+		},
+	}
+
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			clientResource := withProvider(newTestResource(), k)
+			ing := initIngress(clientResource, "app1-svc")
+
+			assert.Equal(t, v.annotations, ing.Annotations)
+			assert.Equal(t, v.paths, ingressPaths(ing))
+			rewrite := initRewriteIngress(clientResource, "app1-svc")
+			if v.rewritePaths == nil {
+				assert.Nil(t, rewrite)
+				return
+			}
+			assert.Equal(t, "app1-rewrite-ingress", rewrite.Name)
+			assert.Equal(t, map[string]string{annotationTraefikMiddlewares: "namespace1-app1-stripprefix@kubernetescrd"}, rewrite.Annotations)
+			assert.Equal(t, v.rewritePaths, ingressPaths(rewrite))
+		})
+	}
+
+	// no annotation is needed when no route is rewritten
+	for k := range tests {
+		clientResource := withProvider(newTestResource(), k)
+		clientResource.Spec.Routes = []httpapiv2.RouteSpec{{Path: "/"}}
+		assert.Nil(t, initIngress(clientResource, "app1-svc").Annotations)
+		assert.Nil(t, initRewriteIngress(clientResource, "app1-svc"))
+	}
+
+	// the ingress routes all the paths when all the routes are rewritten
+	clientResource := withProvider(newTestResource(), httpapiv2.IngressProviderTraefik)
+	clientResource.Spec.Routes = clientResource.Spec.Routes[:2]
+	ing := initIngress(clientResource, "app1-svc")
+	assert.Equal(t, map[string]string{annotationTraefikMiddlewares: "namespace1-app1-stripprefix@kubernetescrd"}, ing.Annotations)
+	assert.Equal(t, []string{"/api", "/v1/users"}, ingressPaths(ing))
+	assert.Nil(t, initRewriteIngress(clientResource, "app1-svc"))
+}
+
+// TestInitIngressNestedRoutes the rewrite of a route is not applied to the routes nested in it which are not rewritten
+// nor to the paths which only start with it
+func TestInitIngressNestedRoutes(t *testing.T) {
+	noRewrite := false
+	clientResource := withProvider(newTestResource(), httpapiv2.IngressProviderTraefik)
+	clientResource.Spec.Routes = []httpapiv2.RouteSpec{{Path: "/"}, {Path: "/api"}, {Path: "/api/admin", Rewrite: &noRewrite}}
+
+	// traefik: the middleware is referenced only by the ingress of /api
+	ing := initIngress(clientResource, "app1-svc")
+	assert.Nil(t, ing.Annotations)
+	assert.Equal(t, []string{"/", "/api/admin"}, ingressPaths(ing))
+	rewrite := initRewriteIngress(clientResource, "app1-svc")
+	assert.Equal(t, []string{"/api"}, ingressPaths(rewrite))
+	mw, _ := ingressProvider(clientResource).Middleware(clientResource)
+	regexes, _, _ := unstructured.NestedStringSlice(mw.Object, "spec", "stripPrefixRegex", "regex")
+	assert.Equal(t, []string{"^/api(/|$)"}, regexes)
+	strip := regexp.MustCompile(regexes[0])
+	assert.Equal(t, "/api/", strip.FindString("/api/users"))
+	assert.Equal(t, "/api", strip.FindString("/api"))
+	assert.Empty(t, strip.FindString("/apiary"))
+
+	// haproxy: the rule skips /api/admin
+	clientResource.Spec.IngressProvider = httpapiv2.IngressProviderHAProxy
+	ing = initIngress(clientResource, "app1-svc")
+	assert.Equal(t, map[string]string{annotationHAProxyPathRewrite: "^/api(?!/admin(?:/|$))(/|$)(.*) /\\2"}, ing.Annotations)
+	assert.Equal(t, []string{"/", "/api", "/api/admin"}, ingressPaths(ing))
+	assert.Nil(t, initRewriteIngress(clientResource, "app1-svc"))
+}
+
+// ingressPaths returns the paths of the first rule of ing
+func ingressPaths(ing *netv1.Ingress) []string {
+	var paths []string
+	for _, path := range ing.Spec.Rules[0].HTTP.Paths {
+		paths = append(paths, path.Path)
+	}
+	return paths
+}
+
+func TestTraefikMiddleware(t *testing.T) {
+	clientResource := withProvider(newTestResource(), httpapiv2.IngressProviderTraefik)
+
+	mw, required := ingressProvider(clientResource).Middleware(clientResource)
+	assert.True(t, required)
+	assert.Equal(t, traefikMiddlewareGVK, mw.GroupVersionKind())
+	assert.Equal(t, "app1-stripprefix", mw.GetName())
+	assert.Equal(t, "namespace1", mw.GetNamespace())
+	regexes, _, _ := unstructured.NestedStringSlice(mw.Object, "spec", "stripPrefixRegex", "regex")
+	assert.Equal(t, []string{"^/api(/|$)", "^/v1/users(/|$)"}, regexes)
+
+	clientResource.Spec.Routes = nil
+	_, required = ingressProvider(clientResource).Middleware(clientResource)
+	assert.False(t, required)
+
+	// the other providers do not need a middleware
+	mw, _ = ingressProvider(withProvider(newTestResource(), httpapiv2.IngressProviderNginx)).Middleware(clientResource)
+	assert.Nil(t, mw)
+}
+
+// TestCheckIngressRewriteOK positive test for the Traefik provider: the rewritten routes are applied in their own ingress
+func TestCheckIngressRewriteOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+	clientResource := withProvider(newTestResource(), httpapiv2.IngressProviderTraefik)
+
+	applied := map[string]*netv1.Ingress{}
+	notFound := errors.NewNotFound(schema.GroupResource{}, "")
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(notFound).Once()
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*unstructured.Unstructured"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Once()
+	// the ingress, the rewrite ingress and the redirect ingress
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Ingress")).Return(notFound).Times(3)
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*v1.Ingress"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		ing := args.Get(1).(*netv1.Ingress)
+		applied[ing.Name] = ing
+	}).Twice()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Times(3)
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Times(3)
+	defer subResourceWriterMock.AssertExpectations(t)
+	defer clientMock.AssertExpectations(t)
+
+	_, err := reconciler.CheckIngress(ctx, *req, false, clientResource, initService(clientResource))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/admin"}, ingressPaths(applied["app1-ingress"]))
+	assert.Equal(t, []string{"/api", "/v1/users"}, ingressPaths(applied["app1-rewrite-ingress"]))
+	assert.Equal(t, "app1", applied["app1-rewrite-ingress"].OwnerReferences[0].Name)
+}
+
+// TestCheckMiddlewareOK positive test for the Traefik provider: the middleware is created, then deleted when no route is rewritten
+// and when the provider is changed
+func TestCheckMiddlewareOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+	clientResource := withProvider(newTestResource(), httpapiv2.IngressProviderTraefik)
+
+	var applied *unstructured.Unstructured
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(errors.NewNotFound(schema.GroupResource{}, "")).Once()
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*unstructured.Unstructured"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		applied = args.Get(1).(*unstructured.Unstructured)
+	}).Once()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+	defer subResourceWriterMock.AssertExpectations(t)
+	defer clientMock.AssertExpectations(t)
+
+	err := reconciler.CheckMiddleware(ctx, *req, false, clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "app1", applied.GetOwnerReferences()[0].Name)
+	assert.True(t, isConditionTrue(clientResource, httpapiv2.ConditionIngressReady))
+	assertEvent(t, reconciler, httpapiv2.ReasonCreated)
+
+	// the routes are not rewritten any more
+	live, _ := ingressProvider(clientResource).Middleware(clientResource)
+	assert.NoError(t, ctrl.SetControllerReference(clientResource, live, reconciler.Scheme))
+	clientResource.Spec.Routes = nil
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(nil).Run(func(args mock.Arguments) {
+		live.DeepCopyInto(args.Get(2).(*unstructured.Unstructured))
+	}).Once()
+	clientMock.On("Delete", mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(nil).Once()
+
+	err = reconciler.CheckMiddleware(ctx, *req, true, clientResource)
+
+	assert.NoError(t, err)
+	assertEvent(t, reconciler, httpapiv2.ReasonDeleted)
+
+	// the provider has been changed from traefik
+	clientResource = withProvider(newTestResource(), httpapiv2.IngressProviderNginx)
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(nil).Run(func(args mock.Arguments) {
+		live.DeepCopyInto(args.Get(2).(*unstructured.Unstructured))
+	}).Once()
+	clientMock.On("Delete", mock.Anything, mock.AnythingOfType("*unstructured.Unstructured")).Return(nil).Once()
+
+	err = reconciler.CheckMiddleware(ctx, *req, true, clientResource)
+
+	assert.NoError(t, err)
+	assertEvent(t, reconciler, httpapiv2.ReasonDeleted)
+}
+
+// watchRecorder is a controller recording its watches
+type watchRecorder struct {
+	controller.Controller
+	sources []source.Source
+}
+
+func (c *watchRecorder) Watch(src source.Source, eventhandler handler.EventHandler, predicates ...predicate.Predicate) error {
+	c.sources = append(c.sources, src)
+	return nil
+}
+
+// TestWatchMiddlewares the middlewares are watched once their CRD is installed
+func TestWatchMiddlewares(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	c := &watchRecorder{}
+
+	// the operator stops before the CRD is installed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, watchMiddlewares(ctx, mapper, c))
+	assert.Empty(t, c.sources)
+
+	mapper.Add(traefikMiddlewareGVK, meta.RESTScopeNamespace)
+	assert.NoError(t, watchMiddlewares(context.Background(), mapper, c))
+	assert.Len(t, c.sources, 1)
+	assert.Equal(t, traefikMiddlewareGVK, c.sources[0].(*source.Kind).Type.GetObjectKind().GroupVersionKind())
+}
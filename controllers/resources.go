@@ -4,19 +4,130 @@ import (
 	"fmt"
 	"strings"
 
-	httpapiv1 "github.com/akosbalogh005/easyhttp-operator/api/v1"
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
 	netv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// annotations of the ingress set by the operator
+const (
+	annotationCertManEditInPlace = "acme.cert-manager.io/http01-edit-in-place"
+	annotationCertManIssuer      = "cert-manager.io/issuer"
+	annotationNginxRewriteTarget = "nginx.ingress.kubernetes.io/rewrite-target"
+	annotationNginxRedirect      = "nginx.ingress.kubernetes.io/permanent-redirect"
+)
+
+// appPortName is the name of the application port in the container and the service
+const appPortName = "http"
+
+// tlsSecretName returns the name of the secret where cert manager stores the certificate of the host
+func tlsSecretName(clientResource *httpapiv2.EasyHttp) string {
+	return strings.ReplaceAll(clientResource.Spec.Host, ".", "-") + "-tls"
+}
+
+// tlsHosts returns the hosts of the certificate: the host and its aliases
+func tlsHosts(clientResource *httpapiv2.EasyHttp) []string {
+	return append([]string{clientResource.Spec.Host}, clientResource.Spec.Aliases...)
+}
+
+// routedHosts returns the hosts routed to the application: the host and the aliases which are not redirected
+func routedHosts(clientResource *httpapiv2.EasyHttp) []string {
+	if clientResource.Spec.RedirectAliases {
+		return []string{clientResource.Spec.Host}
+	}
+	return tlsHosts(clientResource)
+}
+
+// routes returns the routes of clientResource, the root path when there is no route
+func routes(clientResource *httpapiv2.EasyHttp) []httpapiv2.RouteSpec {
+	if len(clientResource.Spec.Routes) == 0 {
+		return []httpapiv2.RouteSpec{{Path: httpapiv2.DefaultPath}}
+	}
+	return clientResource.Spec.Routes
+}
+
+// routePort returns the container port the requests of route are sent to
+func routePort(clientResource *httpapiv2.EasyHttp, route httpapiv2.RouteSpec) int32 {
+	if route.Port != 0 {
+		return route.Port
+	}
+	return clientResource.Spec.Container.Port
+}
+
+// servicePort returns the port of the service of clientResource, container.servicePort or container.port
+func servicePort(clientResource *httpapiv2.EasyHttp) int32 {
+	if clientResource.Spec.Container.ServicePort != 0 {
+		return clientResource.Spec.Container.ServicePort
+	}
+	return clientResource.Spec.Container.Port
+}
+
+// backendPort returns the service port of the container port
+func backendPort(clientResource *httpapiv2.EasyHttp, port int32) int32 {
+	if port == clientResource.Spec.Container.Port {
+		return servicePort(clientResource)
+	}
+	return port
+}
+
+// routePathType returns the ingress path type of route
+func routePathType(route httpapiv2.RouteSpec) netv1.PathType {
+	if route.PathType != nil {
+		return *route.PathType
+	}
+	return netv1.PathTypePrefix
+}
+
+// routeRewritten returns true if the path of route is removed from the requests. The Prefix paths other than the root
+// are rewritten by default.
+func routeRewritten(route httpapiv2.RouteSpec) bool {
+	if route.Path == "" || route.Path == httpapiv2.DefaultPath || routePathType(route) != netv1.PathTypePrefix {
+		return false
+	}
+	return route.Rewrite == nil || *route.Rewrite
+}
+
+// containerPorts returns the ports of the application container: container.port and the other ports of the routes
+func containerPorts(clientResource *httpapiv2.EasyHttp) []int32 {
+	ports := []int32{clientResource.Spec.Container.Port}
+	for _, route := range routes(clientResource) {
+		port := routePort(clientResource, route)
+		found := false
+		for _, p := range ports {
+			found = found || p == port
+		}
+		if !found {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// portName returns the name of the container port, the service port has the same name. The names are valid IANA service
+// names (at most 15 characters), container.port is named http.
+func portName(clientResource *httpapiv2.EasyHttp, port int32) string {
+	if port == clientResource.Spec.Container.Port {
+		return appPortName
+	}
+	return fmt.Sprintf("%s-%d", appPortName, port)
+}
+
 // initService creates service based on clientResource
-func initService(clientResource *httpapiv1.EasyHttp) *corev1.Service {
+func initService(clientResource *httpapiv2.EasyHttp) *corev1.Service {
 	svc := corev1.Service{}
 	var ports []corev1.ServicePort
-	ports = append(ports, corev1.ServicePort{Name: "http", Protocol: "TCP", Port: int32(clientResource.Spec.Port)})
-	svc.APIVersion = "apps/v1"
+	for _, port := range containerPorts(clientResource) {
+		name := portName(clientResource, port)
+		ports = append(ports, corev1.ServicePort{Name: name, Protocol: "TCP", Port: backendPort(clientResource, port),
+			TargetPort: intstr.FromString(name)})
+	}
+	svc.APIVersion = "v1"
+	svc.Kind = "Service"
 	svc.Name = clientResource.Name + "-svc"
 	svc.Namespace = clientResource.Namespace
 	svc.Spec = corev1.ServiceSpec{Ports: ports}
@@ -24,12 +135,26 @@ func initService(clientResource *httpapiv1.EasyHttp) *corev1.Service {
 	return &svc
 }
 
+// deploymentParams are the inputs of the deployment which are not part of the EasyHttp
+type deploymentParams struct {
+	// configChecksum is the checksum of the referenced ConfigMaps and Secrets stamped on the pod template, omitted when empty
+	configChecksum string
+	// resources are the compute resources of the application container resolved from the spec and the size presets
+	resources corev1.ResourceRequirements
+}
+
 // initDeployment creates deployment based on clientResource
-func initDeployment(clientResource *httpapiv1.EasyHttp) *appsv1.Deployment {
+func initDeployment(clientResource *httpapiv2.EasyHttp, params deploymentParams) *appsv1.Deployment {
 	name := clientResource.Name
-	var replicas int32 = 1
-	if clientResource.Spec.Replicas != nil {
-		replicas = *clientResource.Spec.Replicas
+	// the defaults are set by the defaulting webhook, these are used only when it is not running
+	replicas := httpapiv2.DefaultReplicas
+	if clientResource.Spec.Scaling.Replicas != nil {
+		replicas = *clientResource.Spec.Scaling.Replicas
+	}
+	// the replicas are owned by the autoscaler when autoscaling is on
+	var depReplicas *int32
+	if clientResource.Spec.Scaling.Autoscaling == nil {
+		depReplicas = &replicas
 	}
 
 	d := appsv1.Deployment{}
@@ -39,90 +164,307 @@ func initDeployment(clientResource *httpapiv1.EasyHttp) *appsv1.Deployment {
 	d.Namespace = clientResource.Namespace
 
 	cont := corev1.Container{
-		Image: fmt.Sprintf("%s:%s", clientResource.Spec.Image, clientResource.Spec.ImageTag),
-		Name:  name,
-		Env:   convertEnv(clientResource.Spec.Env),
+		Image:     fmt.Sprintf("%s:%s", clientResource.Spec.Container.Image, clientResource.Spec.Container.Tag),
+		Name:      name,
+		Env:       convertEnv(clientResource.Spec.Container.Env),
+		Resources: *params.resources.DeepCopy(),
+	}
+	cont.LivenessProbe, cont.ReadinessProbe, cont.StartupProbe = initProbes(clientResource)
+	for _, envFrom := range clientResource.Spec.Container.EnvFrom {
+		cont.EnvFrom = append(cont.EnvFrom, *envFrom.DeepCopy())
+	}
+	for _, port := range containerPorts(clientResource) {
+		cont.Ports = append(cont.Ports, corev1.ContainerPort{
+			Name:          portName(clientResource, port),
+			ContainerPort: port,
+		})
 	}
-	cont.Ports = append(cont.Ports, corev1.ContainerPort{
-		Name:          name,
-		ContainerPort: int32(clientResource.Spec.Port),
-	})
 
 	temp := corev1.PodTemplateSpec{}
 	temp.Labels = map[string]string{"app": name}
+	if params.configChecksum != "" {
+		temp.Annotations = map[string]string{annotationConfigChecksum: params.configChecksum}
+	}
 	temp.Spec = corev1.PodSpec{}
 	temp.Spec.Containers = append(temp.Spec.Containers, cont)
 
 	d.Spec = appsv1.DeploymentSpec{
-		Replicas: &replicas,
+		Replicas: depReplicas,
 		Selector: &metav1.LabelSelector{
 			MatchLabels: map[string]string{"app": name},
 		},
-		Strategy: appsv1.DeploymentStrategy{Type: "Recreate"},
-		Template: temp,
+		Strategy:                deploymentStrategy(clientResource, replicas),
+		MinReadySeconds:         clientResource.Spec.Strategy.MinReadySeconds,
+		ProgressDeadlineSeconds: clientResource.Spec.Strategy.ProgressDeadlineSeconds,
+		Template:                temp,
 	}
 	return &d
 }
 
-// initIngress creates deployment based on clientResource
-func initIngress(clientResource *httpapiv1.EasyHttp, serviceName string) *netv1.Ingress {
+// deploymentStrategy returns the strategy of the deployment. The pods of an application which can have more than one pod
+// are replaced by rolling update by default, a single pod is recreated.
+func deploymentStrategy(clientResource *httpapiv2.EasyHttp, replicas int32) appsv1.DeploymentStrategy {
+	spec := clientResource.Spec.Strategy
+	strategyType := spec.Type
+	if strategyType == "" {
+		strategyType = appsv1.RecreateDeploymentStrategyType
+		if clientResource.Spec.Scaling.Autoscaling != nil || replicas > 1 {
+			strategyType = appsv1.RollingUpdateDeploymentStrategyType
+		}
+	}
+	strategy := appsv1.DeploymentStrategy{Type: strategyType}
+	if strategyType == appsv1.RollingUpdateDeploymentStrategyType && (spec.MaxSurge != nil || spec.MaxUnavailable != nil) {
+		strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{}
+		if spec.MaxSurge != nil {
+			maxSurge := *spec.MaxSurge
+			strategy.RollingUpdate.MaxSurge = &maxSurge
+		}
+		if spec.MaxUnavailable != nil {
+			maxUnavailable := *spec.MaxUnavailable
+			strategy.RollingUpdate.MaxUnavailable = &maxUnavailable
+		}
+	}
+	return strategy
+}
+
+// initHorizontalPodAutoscaler creates the autoscaler of the application deployment based on clientResource
+func initHorizontalPodAutoscaler(clientResource *httpapiv2.EasyHttp) *autoscalingv2.HorizontalPodAutoscaler {
+	autoscaling := clientResource.Spec.Scaling.Autoscaling
+
+	hpa := autoscalingv2.HorizontalPodAutoscaler{}
+	hpa.APIVersion = "autoscaling/v2"
+	hpa.Kind = "HorizontalPodAutoscaler"
+	hpa.Name = clientResource.Name
+	hpa.Namespace = clientResource.Namespace
+	hpa.Spec = autoscalingv2.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       clientResource.Name,
+		},
+		MaxReplicas: autoscaling.MaxReplicas,
+	}
+	if autoscaling.MinReplicas != nil {
+		minReplicas := *autoscaling.MinReplicas
+		hpa.Spec.MinReplicas = &minReplicas
+	}
+	if autoscaling.TargetCPUUtilizationPercentage != nil {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, utilizationMetric(corev1.ResourceCPU, *autoscaling.TargetCPUUtilizationPercentage))
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, utilizationMetric(corev1.ResourceMemory, *autoscaling.TargetMemoryUtilizationPercentage))
+	}
+	for _, metric := range autoscaling.Metrics {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, *metric.DeepCopy())
+	}
+	return &hpa
+}
+
+// utilizationMetric returns the average utilization metric of the resource name
+func utilizationMetric(name corev1.ResourceName, utilization int32) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2.MetricTarget{
+				Type:               autoscalingv2.UtilizationMetricType,
+				AverageUtilization: &utilization,
+			},
+		},
+	}
+}
+
+// disruptionBudgetRequired returns true if the application pods need a disruption budget: it is configured or
+// the application can have more than one pod. The pods of the BlueGreen strategy are not covered by a disruption budget.
+func disruptionBudgetRequired(clientResource *httpapiv2.EasyHttp) bool {
+	scaling := clientResource.Spec.Scaling
+	switch {
+	case clientResource.Spec.Strategy.Type == httpapiv2.StrategyBlueGreen:
+		return false
+	case clientResource.Spec.DisruptionBudget != nil:
+		return true
+	case scaling.Autoscaling != nil:
+		return scaling.Autoscaling.MaxReplicas > 1
+	default:
+		return scaling.Replicas != nil && *scaling.Replicas > 1
+	}
+}
+
+// initPodDisruptionBudget creates the disruption budget of the application pods based on clientResource
+func initPodDisruptionBudget(clientResource *httpapiv2.EasyHttp) *policyv1.PodDisruptionBudget {
+	pdb := policyv1.PodDisruptionBudget{}
+	pdb.APIVersion = "policy/v1"
+	pdb.Kind = "PodDisruptionBudget"
+	pdb.Name = clientResource.Name
+	pdb.Namespace = clientResource.Namespace
+	pdb.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: map[string]string{"app": clientResource.Name},
+	}
+
+	budget := clientResource.Spec.DisruptionBudget
+	switch {
+	case budget != nil && budget.MinAvailable != nil:
+		minAvailable := *budget.MinAvailable
+		pdb.Spec.MinAvailable = &minAvailable
+	case budget != nil && budget.MaxUnavailable != nil:
+		maxUnavailable := *budget.MaxUnavailable
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	default:
+		maxUnavailable := intstr.FromInt(1)
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	}
+	return &pdb
+}
+
+// initIngress creates the ingress based on clientResource
+func initIngress(clientResource *httpapiv2.EasyHttp, serviceName string) *netv1.Ingress {
 
 	ing := netv1.Ingress{}
-	//ing.APIVersion = "networking.k8s.io/v1"
+	ing.APIVersion = "networking.k8s.io/v1"
 	ing.Kind = "Ingress"
 	ing.Name = clientResource.Name + "-ingress"
 	ing.Namespace = clientResource.Namespace
-	if clientResource.Spec.CertManInssuer != "" {
+	if clientResource.Spec.TLS.Issuer != "" {
 		ing.Annotations = make(map[string]string)
-		ing.Annotations["acme.cert-manager.io/http01-edit-in-place"] = "true"
-		ing.Annotations["cert-manager.io/issuer"] = clientResource.Spec.CertManInssuer
+		ing.Annotations[annotationCertManEditInPlace] = "true"
+		ing.Annotations[annotationCertManIssuer] = clientResource.Spec.TLS.Issuer
 	}
-	if clientResource.Spec.Path != "" && clientResource.Spec.Path != "/" {
-		if len(ing.Annotations) == 0 {
-			ing.Annotations = make(map[string]string)
+	// the rewritten routes are not routed by this ingress when they have their own one
+	provider := ingressProvider(clientResource)
+	separate := provider.SeparateRewrites(clientResource)
+	if !separate {
+		for k, v := range provider.Annotations(clientResource) {
+			if len(ing.Annotations) == 0 {
+				ing.Annotations = make(map[string]string)
+			}
+			ing.Annotations[k] = v
 		}
-		ing.Annotations["nginx.ingress.kubernetes.io/rewrite-target"] = "/$2"
 	}
 
-	pfrx := netv1.PathTypePrefix
+	ingressPaths := routePaths(clientResource, serviceName, func(route httpapiv2.RouteSpec) bool {
+		return !separate || !routeRewritten(route)
+	})
+	ing.Spec = netv1.IngressSpec{Rules: ingressRules(routedHosts(clientResource), ingressPaths...)}
+	if clientResource.Spec.TLS.Issuer != "" {
+		// one certificate covers the host and all its aliases
+		ing.Spec.TLS = []netv1.IngressTLS{{
+			Hosts:      tlsHosts(clientResource),
+			SecretName: tlsSecretName(clientResource),
+		}}
+	}
+	if clientResource.Spec.IngressClassName != "" {
+		className := clientResource.Spec.IngressClassName
+		ing.Spec.IngressClassName = &className
+	}
+
+	return &ing
+}
 
-	p := "/"
-	if clientResource.Spec.Path != "" {
-		p = clientResource.Spec.Path + "(/|$)(.*)"
+// initRewriteIngress creates the ingress of the rewritten routes of clientResource holding the annotations of its ingress
+// provider, nil when they are routed by the ingress of the application
+func initRewriteIngress(clientResource *httpapiv2.EasyHttp, serviceName string) *netv1.Ingress {
+	provider := ingressProvider(clientResource)
+	if !provider.SeparateRewrites(clientResource) {
+		return nil
 	}
 
-	ingressPath := netv1.HTTPIngressPath{
-		Path:     p,
-		PathType: &pfrx,
-		Backend: netv1.IngressBackend{
-			Service: &netv1.IngressServiceBackend{
-				Name: serviceName,
-				Port: netv1.ServiceBackendPort{
-					Number: int32(clientResource.Spec.Port),
+	ing := netv1.Ingress{}
+	ing.APIVersion = "networking.k8s.io/v1"
+	ing.Kind = "Ingress"
+	ing.Name = clientResource.Name + "-rewrite-ingress"
+	ing.Namespace = clientResource.Namespace
+	ing.Annotations = provider.Annotations(clientResource)
+	ing.Spec = netv1.IngressSpec{Rules: ingressRules(routedHosts(clientResource), routePaths(clientResource, serviceName, routeRewritten)...)}
+	if clientResource.Spec.TLS.Issuer != "" {
+		// the certificate is requested by the ingress of the application
+		ing.Spec.TLS = []netv1.IngressTLS{{
+			Hosts:      tlsHosts(clientResource),
+			SecretName: tlsSecretName(clientResource),
+		}}
+	}
+	if clientResource.Spec.IngressClassName != "" {
+		className := clientResource.Spec.IngressClassName
+		ing.Spec.IngressClassName = &className
+	}
+	return &ing
+}
+
+// routePaths returns the ingress paths of the routes of clientResource selected by include
+func routePaths(clientResource *httpapiv2.EasyHttp, serviceName string, include func(route httpapiv2.RouteSpec) bool) []netv1.HTTPIngressPath {
+	provider := ingressProvider(clientResource)
+	var paths []netv1.HTTPIngressPath
+	for _, route := range routes(clientResource) {
+		if !include(route) {
+			continue
+		}
+		pathType := routePathType(route)
+		paths = append(paths, netv1.HTTPIngressPath{
+			Path:     provider.Path(clientResource, route),
+			PathType: &pathType,
+			Backend: netv1.IngressBackend{
+				Service: &netv1.IngressServiceBackend{
+					Name: serviceName,
+					Port: netv1.ServiceBackendPort{
+						Number: backendPort(clientResource, routePort(clientResource, route)),
+					},
 				},
 			},
-		},
+		})
 	}
-	httpIngressRuleValue := netv1.HTTPIngressRuleValue{Paths: []netv1.HTTPIngressPath{ingressPath}}
-	rule := netv1.IngressRule{}
-	rule.Host = clientResource.Spec.Host
-	rule.IngressRuleValue.HTTP = &httpIngressRuleValue
+	return paths
+}
 
-	if clientResource.Spec.CertManInssuer != "" {
-		tls := netv1.IngressTLS{
-			Hosts:      []string{clientResource.Spec.Host},
-			SecretName: strings.ReplaceAll(clientResource.Spec.Host, ".", "-") + "-tls",
-		}
-		ing.Spec = netv1.IngressSpec{
-			Rules: []netv1.IngressRule{rule},
-			TLS:   []netv1.IngressTLS{tls},
-		}
-	} else {
-		ing.Spec = netv1.IngressSpec{
-			Rules: []netv1.IngressRule{rule},
+// ingressRules returns one rule with the paths for each host
+func ingressRules(hosts []string, paths ...netv1.HTTPIngressPath) []netv1.IngressRule {
+	var rules []netv1.IngressRule
+	for _, host := range hosts {
+		rule := netv1.IngressRule{Host: host}
+		rule.IngressRuleValue.HTTP = &netv1.HTTPIngressRuleValue{}
+		for _, path := range paths {
+			rule.IngressRuleValue.HTTP.Paths = append(rule.IngressRuleValue.HTTP.Paths, *path.DeepCopy())
 		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
 
+// initRedirectIngress creates the ingress of nginx redirecting the requests of the aliases of clientResource to its host
+// permanently. The requests are not sent to the backend of the ingress.
+func initRedirectIngress(clientResource *httpapiv2.EasyHttp, serviceName string) *netv1.Ingress {
+	scheme := "http"
+	if clientResource.Spec.TLS.Issuer != "" {
+		scheme = "https"
 	}
 
+	ing := netv1.Ingress{}
+	ing.APIVersion = "networking.k8s.io/v1"
+	ing.Kind = "Ingress"
+	ing.Name = clientResource.Name + "-redirect-ingress"
+	ing.Namespace = clientResource.Namespace
+	ing.Annotations = map[string]string{annotationNginxRedirect: fmt.Sprintf("%s://%s$request_uri", scheme, clientResource.Spec.Host)}
+
+	pfrx := netv1.PathTypePrefix
+	redirectPath := netv1.HTTPIngressPath{
+		Path:     httpapiv2.DefaultPath,
+		PathType: &pfrx,
+		Backend: netv1.IngressBackend{
+			Service: &netv1.IngressServiceBackend{
+				Name: serviceName,
+				Port: netv1.ServiceBackendPort{Number: servicePort(clientResource)},
+			},
+		},
+	}
+	ing.Spec = netv1.IngressSpec{Rules: ingressRules(clientResource.Spec.Aliases, redirectPath)}
+	if clientResource.Spec.TLS.Issuer != "" {
+		// the certificate is requested by the ingress of the application
+		ing.Spec.TLS = []netv1.IngressTLS{{
+			Hosts:      append([]string(nil), clientResource.Spec.Aliases...),
+			SecretName: tlsSecretName(clientResource),
+		}}
+	}
+	if clientResource.Spec.IngressClassName != "" {
+		className := clientResource.Spec.IngressClassName
+		ing.Spec.IngressClassName = &className
+	}
 	return &ing
 }
@@ -8,48 +8,82 @@ import (
 
 	"text/template"
 
-	httpapiv1 "github.com/akosbalogh005/easyhttp-operator/api/v1"
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func getTempleate(t *testing.T, fileName string) *template.Template {
 	depTmp, err := os.ReadFile(filepath.Join("templates", fileName))
 	assert.NoError(t, err)
-	depTemplate, err := template.New("dep").Parse(string(depTmp))
+	depTemplate, err := template.New("dep").Funcs(template.FuncMap{"deref": deref, "hosts": hosts}).Parse(string(depTmp))
 	assert.NoError(t, err)
 	return depTemplate
 }
 
+// hosts returns the hosts of the ingress rules of the spec, the redirected aliases are not routed to the application
+func hosts(spec httpapiv2.EasyHttpSpec) []string {
+	if spec.RedirectAliases {
+		return []string{spec.Host}
+	}
+	return append([]string{spec.Host}, spec.Aliases...)
+}
+
+// deref returns the value of an optional int32 of the spec, the default replicas when it is not set
+func deref(p *int32) int32 {
+	if p == nil {
+		return httpapiv2.DefaultReplicas
+	}
+	return *p
+}
+
 func TestInitDeployment(t *testing.T) {
 
-	clientResource := httpapiv1.EasyHttp{}
+	clientResource := httpapiv2.EasyHttp{}
 	clientResource.Name = "app1"
 	clientResource.Namespace = "namespace1"
 
-	var replicas3 int32 = 3
+	var replicas3, deadline int32 = 3, 120
 
-	tests := map[string]httpapiv1.EasyHttpSpec{
+	tests := map[string]httpapiv2.EasyHttpSpec{
 		"with env, 3 replicas": {
-			Host:           "testhost",
-			Replicas:       &replicas3,
-			Image:          "testimage",
-			ImageTag:       "1.0",
-			Port:           1234,
-			Env:            map[string]string{"PORT": "1234"},
-			CertManInssuer: "local.issuer",
-			Path:           "/app",
+			Host: "testhost",
+			Container: httpapiv2.ContainerSpec{
+				Image: "testimage",
+				Tag:   "1.0",
+				Port:  1234,
+				Env:   []httpapiv2.EnvVar{{Name: "PORT", Value: "1234"}},
+			},
+			Routes:  []httpapiv2.RouteSpec{{Path: "/app"}},
+			TLS:     httpapiv2.TLSSpec{Issuer: "local.issuer"},
+			Scaling: httpapiv2.ScalingSpec{Replicas: &replicas3},
+		},
+		"recreate, min ready, progress deadline": {
+			Host: "testhost3",
+			Container: httpapiv2.ContainerSpec{
+				Image: "testimage3",
+				Tag:   "1.0",
+				Port:  1234,
+			},
+			Scaling:  httpapiv2.ScalingSpec{Replicas: &replicas3},
+			Strategy: httpapiv2.StrategySpec{Type: "Recreate", MinReadySeconds: 10, ProgressDeadlineSeconds: &deadline},
 		},
 		"no envs, no replicas": {
-			Host:           "testhost2",
-			Replicas:       nil,
-			Image:          "testimage2",
-			ImageTag:       "1.0",
-			Port:           1234,
-			Env:            nil,
-			CertManInssuer: "local.issuer",
-			Path:           "/app",
+			Host: "testhost2",
+			Container: httpapiv2.ContainerSpec{
+				Image: "testimage2",
+				Tag:   "1.0",
+				Port:  1234,
+			},
+			Routes: []httpapiv2.RouteSpec{{Path: "/app"}},
+			TLS:    httpapiv2.TLSSpec{Issuer: "local.issuer"},
 		},
 	}
 
@@ -57,7 +91,7 @@ func TestInitDeployment(t *testing.T) {
 		t.Run(k, func(t *testing.T) {
 
 			clientResource.Spec = *v.DeepCopy()
-			dep := initDeployment(&clientResource)
+			dep := initDeployment(&clientResource, deploymentParams{})
 			createdYaml, err := yaml.Marshal(dep)
 			assert.NoError(t, err)
 
@@ -71,15 +105,165 @@ func TestInitDeployment(t *testing.T) {
 	}
 }
 
+func TestDeploymentStrategy(t *testing.T) {
+	surge, unavailable := intstr.FromString("50%"), intstr.FromInt(0)
+
+	tests := map[string]struct {
+		spec     httpapiv2.EasyHttpSpec
+		replicas int32
+		expected appsv1.DeploymentStrategy
+	}{
+		"single replica":    {replicas: 1, expected: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}},
+		"multiple replicas": {replicas: 2, expected: appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}},
+		"autoscaling": {
+			spec:     httpapiv2.EasyHttpSpec{Scaling: httpapiv2.ScalingSpec{Autoscaling: &httpapiv2.AutoscalingSpec{MaxReplicas: 3}}},
+			replicas: 1,
+			expected: appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType},
+		},
+		"rolling update of single replica": {
+			spec:     httpapiv2.EasyHttpSpec{Strategy: httpapiv2.StrategySpec{Type: appsv1.RollingUpdateDeploymentStrategyType, MaxSurge: &surge, MaxUnavailable: &unavailable}},
+			replicas: 1,
+			expected: appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &surge, MaxUnavailable: &unavailable}},
+		},
+		"recreate multiple replicas": {
+			spec:     httpapiv2.EasyHttpSpec{Strategy: httpapiv2.StrategySpec{Type: appsv1.RecreateDeploymentStrategyType}},
+			replicas: 3,
+			expected: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+		},
+	}
+
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			clientResource := httpapiv2.EasyHttp{Spec: v.spec}
+
+			assert.Equal(t, v.expected, deploymentStrategy(&clientResource, v.replicas))
+		})
+	}
+}
+
+func TestInitDeploymentEnvSources(t *testing.T) {
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Name = "app1"
+	clientResource.Namespace = "namespace1"
+	secretRef := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}
+	configMapRef := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Key: "mode"}
+	fieldRef := &corev1.ObjectFieldSelector{FieldPath: "status.podIP"}
+	envFrom := []corev1.EnvFromSource{{Prefix: "APP_", ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}}}
+	clientResource.Spec.Container = httpapiv2.ContainerSpec{
+		Image: "testimage",
+		Tag:   "1.0",
+		Port:  1234,
+		Env: []httpapiv2.EnvVar{
+			{Name: "PORT", Value: "1234"},
+			{Name: "PASSWORD", ValueFrom: &httpapiv2.EnvVarSource{SecretKeyRef: secretRef}},
+			{Name: "MODE", ValueFrom: &httpapiv2.EnvVarSource{ConfigMapKeyRef: configMapRef}},
+			{Name: "POD_IP", ValueFrom: &httpapiv2.EnvVarSource{FieldRef: fieldRef}},
+		},
+		EnvFrom: envFrom,
+	}
+
+	dep := initDeployment(&clientResource, deploymentParams{})
+
+	cont := dep.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "PORT", Value: "1234"},
+		{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: secretRef}},
+		{Name: "MODE", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: configMapRef}},
+		{Name: "POD_IP", ValueFrom: &corev1.EnvVarSource{FieldRef: fieldRef}},
+	}, cont.Env)
+	assert.Equal(t, envFrom, cont.EnvFrom)
+}
+
+func TestInitHorizontalPodAutoscaler(t *testing.T) {
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Name = "app1"
+	clientResource.Namespace = "namespace1"
+	var minReplicas, cpu, memory int32 = 2, 70, 80
+	podsMetric := autoscalingv2.MetricSpec{
+		Type: autoscalingv2.PodsMetricSourceType,
+		Pods: &autoscalingv2.PodsMetricSource{
+			Metric: autoscalingv2.MetricIdentifier{Name: "http_requests_per_second"},
+			Target: autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: resource.NewQuantity(100, resource.DecimalSI)},
+		},
+	}
+	clientResource.Spec.Scaling.Autoscaling = &httpapiv2.AutoscalingSpec{
+		MinReplicas:                       &minReplicas,
+		MaxReplicas:                       10,
+		TargetCPUUtilizationPercentage:    &cpu,
+		TargetMemoryUtilizationPercentage: &memory,
+		Metrics:                           []autoscalingv2.MetricSpec{podsMetric},
+	}
+
+	hpa := initHorizontalPodAutoscaler(&clientResource)
+
+	assert.Equal(t, "app1", hpa.Name)
+	assert.Equal(t, "namespace1", hpa.Namespace)
+	assert.Equal(t, autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app1"}, hpa.Spec.ScaleTargetRef)
+	assert.Equal(t, &minReplicas, hpa.Spec.MinReplicas)
+	assert.Equal(t, int32(10), hpa.Spec.MaxReplicas)
+	assert.Equal(t, []autoscalingv2.MetricSpec{utilizationMetric(corev1.ResourceCPU, 70), utilizationMetric(corev1.ResourceMemory, 80), podsMetric}, hpa.Spec.Metrics)
+
+	// the replicas of the deployment are owned by the autoscaler
+	assert.Nil(t, initDeployment(&clientResource, deploymentParams{}).Spec.Replicas)
+}
+
+func TestInitPodDisruptionBudget(t *testing.T) {
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Name = "app1"
+	clientResource.Namespace = "namespace1"
+	one, twoPods, quarter := intstr.FromInt(1), intstr.FromInt(2), intstr.FromString("25%")
+	var replicas1, replicas3 int32 = 1, 3
+
+	tests := map[string]struct {
+		scaling        httpapiv2.ScalingSpec
+		budget         *httpapiv2.DisruptionBudgetSpec
+		required       bool
+		minAvailable   *intstr.IntOrString
+		maxUnavailable *intstr.IntOrString
+	}{
+		"single replica":               {scaling: httpapiv2.ScalingSpec{Replicas: &replicas1}, maxUnavailable: &one},
+		"multiple replicas":            {scaling: httpapiv2.ScalingSpec{Replicas: &replicas3}, required: true, maxUnavailable: &one},
+		"autoscaling":                  {scaling: httpapiv2.ScalingSpec{Autoscaling: &httpapiv2.AutoscalingSpec{MaxReplicas: 3}}, required: true, maxUnavailable: &one},
+		"single replica with budget":   {scaling: httpapiv2.ScalingSpec{Replicas: &replicas1}, budget: &httpapiv2.DisruptionBudgetSpec{}, required: true, maxUnavailable: &one},
+		"min available":                {budget: &httpapiv2.DisruptionBudgetSpec{MinAvailable: &twoPods}, required: true, minAvailable: &twoPods},
+		"max unavailable percentage":   {budget: &httpapiv2.DisruptionBudgetSpec{MaxUnavailable: &quarter}, required: true, maxUnavailable: &quarter},
+		"autoscaling with one replica": {scaling: httpapiv2.ScalingSpec{Autoscaling: &httpapiv2.AutoscalingSpec{MaxReplicas: 1}}, maxUnavailable: &one},
+	}
+
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			clientResource.Spec.Scaling = v.scaling
+			clientResource.Spec.DisruptionBudget = v.budget
+
+			pdb := initPodDisruptionBudget(&clientResource)
+
+			assert.Equal(t, v.required, disruptionBudgetRequired(&clientResource))
+			assert.Equal(t, "app1", pdb.Name)
+			assert.Equal(t, map[string]string{"app": "app1"}, pdb.Spec.Selector.MatchLabels)
+			assert.Equal(t, v.minAvailable, pdb.Spec.MinAvailable)
+			assert.Equal(t, v.maxUnavailable, pdb.Spec.MaxUnavailable)
+		})
+	}
+}
+
 func TestInitService(t *testing.T) {
 
-	clientResource := httpapiv1.EasyHttp{}
+	clientResource := httpapiv2.EasyHttp{}
 	clientResource.Name = "app1"
 	clientResource.Namespace = "namespace1"
 
-	tests := map[string]httpapiv1.EasyHttpSpec{
+	tests := map[string]httpapiv2.EasyHttpSpec{
 		"port_1234": {
-			Port: 1234,
+			Container: httpapiv2.ContainerSpec{
+				Port: 1234,
+			},
+		},
+		"service port 80": {
+			Container: httpapiv2.ContainerSpec{
+				Port:        8080,
+				ServicePort: 80,
+			},
 		},
 	}
 
@@ -102,37 +286,71 @@ func TestInitService(t *testing.T) {
 
 func TestInitIngress(t *testing.T) {
 
-	clientResource := httpapiv1.EasyHttp{}
+	clientResource := httpapiv2.EasyHttp{}
 	clientResource.Name = "app1"
 	clientResource.Namespace = "namespace1"
 
-	tests := map[string]httpapiv1.EasyHttpSpec{
+	tests := map[string]httpapiv2.EasyHttpSpec{
 		"with path, no issuer": {
-			Host:           "testhost",
-			Replicas:       nil,
-			Image:          "testimage",
-			ImageTag:       "1.0",
-			Port:           1234,
-			Env:            map[string]string{"PORT": "1111", "PORT2": "1234"},
-			CertManInssuer: "local.issuer",
-			Path:           "/app",
+			Host: "testhost",
+			Container: httpapiv2.ContainerSpec{
+				Image: "testimage",
+				Tag:   "1.0",
+				Port:  1234,
+				Env:   []httpapiv2.EnvVar{{Name: "PORT", Value: "1111"}, {Name: "PORT2", Value: "1234"}},
+			},
+			Routes: []httpapiv2.RouteSpec{{Path: "/app"}},
+			TLS:    httpapiv2.TLSSpec{Issuer: "local.issuer"},
 		},
 		"no path, with issuer": {
-			Host:           "testhost",
-			Replicas:       nil,
-			Image:          "testimage",
-			ImageTag:       "1.0",
-			Port:           1234,
-			Env:            map[string]string{"PORT": "1111", "PORT2": "1234"},
-			CertManInssuer: "local.issuer",
+			Host: "testhost",
+			Container: httpapiv2.ContainerSpec{
+				Image: "testimage",
+				Tag:   "1.0",
+				Port:  1234,
+				Env:   []httpapiv2.EnvVar{{Name: "PORT", Value: "1111"}, {Name: "PORT2", Value: "1234"}},
+			},
+			TLS: httpapiv2.TLSSpec{Issuer: "local.issuer"},
+		},
+		"service port, with issuer": {
+			Host:      "testhost",
+			Container: httpapiv2.ContainerSpec{Image: "testimage", Tag: "1.0", Port: 8080, ServicePort: 80},
+			Routes:    []httpapiv2.RouteSpec{{Path: "/app"}},
+			TLS:       httpapiv2.TLSSpec{Issuer: "local.issuer"},
 		},
 		"no path, no issuer": {
-			Host:     "testhost",
-			Replicas: nil,
-			Image:    "testimage",
-			ImageTag: "1.0",
-			Port:     1234,
-			Env:      map[string]string{"PORT": "1111", "PORT2": "1234"},
+			Host: "testhost",
+			Container: httpapiv2.ContainerSpec{
+				Image: "testimage",
+				Tag:   "1.0",
+				Port:  1234,
+				Env:   []httpapiv2.EnvVar{{Name: "PORT", Value: "1111"}, {Name: "PORT2", Value: "1234"}},
+			},
+		},
+		"aliases, with issuer": {
+			Host:      "testhost",
+			Aliases:   []string{"alias1", "alias2"},
+			Container: httpapiv2.ContainerSpec{Image: "testimage", Tag: "1.0", Port: 1234},
+			Routes:    []httpapiv2.RouteSpec{{Path: "/app"}},
+			TLS:       httpapiv2.TLSSpec{Issuer: "local.issuer"},
+		},
+		"redirected aliases, with issuer": {
+			Host:            "testhost",
+			Aliases:         []string{"alias1", "alias2"},
+			RedirectAliases: true,
+			Container:       httpapiv2.ContainerSpec{Image: "testimage", Tag: "1.0", Port: 1234},
+			TLS:             httpapiv2.TLSSpec{Issuer: "local.issuer"},
+		},
+		"root path, with issuer, ingress class": {
+			Host:             "testhost",
+			IngressClassName: "nginx",
+			Container: httpapiv2.ContainerSpec{
+				Image: "testimage",
+				Tag:   "1.0",
+				Port:  1234,
+			},
+			Routes: []httpapiv2.RouteSpec{{Path: "/"}},
+			TLS:    httpapiv2.TLSSpec{Issuer: "local.issuer"},
 		},
 	}
 
@@ -153,3 +371,90 @@ func TestInitIngress(t *testing.T) {
 		})
 	}
 }
+
+func TestInitRedirectIngress(t *testing.T) {
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Name = "app1"
+	clientResource.Namespace = "namespace1"
+	clientResource.Spec = httpapiv2.EasyHttpSpec{
+		Host:             "example.net",
+		Aliases:          []string{"www.example.net", "example.org"},
+		RedirectAliases:  true,
+		IngressClassName: "nginx",
+		Container:        httpapiv2.ContainerSpec{Image: "testimage", Tag: "1.0", Port: 1234},
+		TLS:              httpapiv2.TLSSpec{Issuer: "local.issuer"},
+	}
+
+	ing := initRedirectIngress(&clientResource, "app1-svc")
+	assert.Equal(t, "app1-redirect-ingress", ing.Name)
+	assert.Equal(t, map[string]string{annotationNginxRedirect: "https://example.net$request_uri"}, ing.Annotations)
+	assert.Len(t, ing.Spec.Rules, 2)
+	assert.Equal(t, "www.example.net", ing.Spec.Rules[0].Host)
+	assert.Equal(t, "example.org", ing.Spec.Rules[1].Host)
+	assert.Equal(t, []string{"www.example.net", "example.org"}, ing.Spec.TLS[0].Hosts)
+	assert.Equal(t, "example-net-tls", ing.Spec.TLS[0].SecretName)
+	assert.Equal(t, "nginx", *ing.Spec.IngressClassName)
+
+	// without certificate the redirect is plain http
+	clientResource.Spec.TLS.Issuer = ""
+	ing = initRedirectIngress(&clientResource, "app1-svc")
+	assert.Equal(t, "http://example.net$request_uri", ing.Annotations[annotationNginxRedirect])
+	assert.Nil(t, ing.Spec.TLS)
+}
+
+func TestInitRoutes(t *testing.T) {
+	clientResource := httpapiv2.EasyHttp{}
+	clientResource.Name = "app1"
+	clientResource.Namespace = "namespace1"
+	exact, specific, noRewrite := netv1.PathTypeExact, netv1.PathTypeImplementationSpecific, false
+	clientResource.Spec = httpapiv2.EasyHttpSpec{
+		Host:      "testhost",
+		Container: httpapiv2.ContainerSpec{Image: "testimage", Tag: "1.0", Port: 1234, ServicePort: 80},
+		Routes: []httpapiv2.RouteSpec{
+			{Path: "/api"},
+			{Path: "/admin", Port: 9090, Rewrite: &noRewrite},
+			{Path: "/health", PathType: &exact},
+			{Path: "/metrics", PathType: &specific, Port: 9090},
+			{Path: "/"},
+		},
+	}
+
+	dep := initDeployment(&clientResource, deploymentParams{})
+	assert.Equal(t, []corev1.ContainerPort{{Name: "http", ContainerPort: 1234}, {Name: "http-9090", ContainerPort: 9090}},
+		dep.Spec.Template.Spec.Containers[0].Ports)
+
+	svc := initService(&clientResource)
+	assert.Equal(t, []corev1.ServicePort{
+		{Name: "http", Protocol: "TCP", Port: 80, TargetPort: intstr.FromString("http")},
+		{Name: "http-9090", Protocol: "TCP", Port: 9090, TargetPort: intstr.FromString("http-9090")},
+	}, svc.Spec.Ports)
+
+	ing := initIngress(&clientResource, svc.Name)
+	assert.Equal(t, "/$2", ing.Annotations[annotationNginxRewriteTarget])
+	paths := ing.Spec.Rules[0].HTTP.Paths
+	assert.Len(t, paths, 5)
+	expected := []struct {
+		path     string
+		pathType netv1.PathType
+		port     int32
+	}{
+		{"/api(/|$)(.*)", netv1.PathTypePrefix, 80},
+		{"/()(admin(?:/|$).*)", netv1.PathTypePrefix, 9090},
+		{"/()(health)$", netv1.PathTypeExact, 80},
+		{"/metrics", netv1.PathTypeImplementationSpecific, 9090},
+		{"/()(.*)", netv1.PathTypePrefix, 80},
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.path, paths[i].Path)
+		assert.Equal(t, e.pathType, *paths[i].PathType)
+		assert.Equal(t, "app1-svc", paths[i].Backend.Service.Name)
+		assert.Equal(t, e.port, paths[i].Backend.Service.Port.Number)
+	}
+
+	// the paths are not regular expressions when no route is rewritten
+	clientResource.Spec.Routes = []httpapiv2.RouteSpec{{Path: "/admin", Port: 9090, Rewrite: &noRewrite}, {Path: "/health", PathType: &exact}}
+	ing = initIngress(&clientResource, svc.Name)
+	assert.NotContains(t, ing.Annotations, annotationNginxRewriteTarget)
+	assert.Equal(t, "/admin", ing.Spec.Rules[0].HTTP.Paths[0].Path)
+	assert.Equal(t, "/health", ing.Spec.Rules[0].HTTP.Paths[1].Path)
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// labels and annotations of the revisions of the spec
+const (
+	labelRevisionOwner        = "httpapi.github.com/easyhttp"
+	annotationRevisionImage   = "httpapi.github.com/image"
+	annotationRevisionApplied = "httpapi.github.com/applied-at"
+)
+
+// revisionSpec returns the spec of clientResource recorded in a revision. The scaling and the history limit are not part
+// of the revisions, so they are not changed by a rollback.
+func revisionSpec(spec *httpapiv2.EasyHttpSpec) *httpapiv2.EasyHttpSpec {
+	recorded := spec.DeepCopy()
+	recorded.Scaling = httpapiv2.ScalingSpec{}
+	recorded.RevisionHistoryLimit = nil
+	return recorded
+}
+
+// revisionName returns the name of the revision recording the current spec of clientResource, derived from the hash of
+// the spec, and the recorded spec
+func revisionName(clientResource *httpapiv2.EasyHttp) (string, []byte, error) {
+	data, err := json.Marshal(revisionSpec(&clientResource.Spec))
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot encode spec. %v", err)
+	}
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return clientResource.Name + "-" + rand.SafeEncodeString(strconv.FormatUint(uint64(hasher.Sum32()), 10)), data, nil
+}
+
+// initRevision creates the revision recording the current spec of clientResource
+func initRevision(clientResource *httpapiv2.EasyHttp, revision int64) (*appsv1.ControllerRevision, error) {
+	name, data, err := revisionName(clientResource)
+	if err != nil {
+		return nil, err
+	}
+
+	rev := appsv1.ControllerRevision{}
+	rev.APIVersion = "apps/v1"
+	rev.Kind = "ControllerRevision"
+	rev.Name = name
+	rev.Namespace = clientResource.Namespace
+	rev.Labels = map[string]string{labelRevisionOwner: clientResource.Name}
+	rev.Annotations = map[string]string{
+		annotationRevisionImage:   fmt.Sprintf("%s:%s", clientResource.Spec.Container.Image, clientResource.Spec.Container.Tag),
+		annotationRevisionApplied: time.Now().UTC().Format(time.RFC3339),
+	}
+	rev.Data = runtime.RawExtension{Raw: data}
+	rev.Revision = revision
+	return &rev, nil
+}
+
+// listRevisions returns the revisions of clientResource ordered by their number
+func (r *EasyHttpReconciler) listRevisions(ctx context.Context, clientResource *httpapiv2.EasyHttp) ([]*appsv1.ControllerRevision, error) {
+	list := &appsv1.ControllerRevisionList{}
+	if err := r.List(ctx, list, client.InNamespace(clientResource.Namespace), client.MatchingLabels{labelRevisionOwner: clientResource.Name}); err != nil {
+		return nil, fmt.Errorf("cannot list revisions, retying later. %v", err)
+	}
+	var revisions []*appsv1.ControllerRevision
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], clientResource) {
+			revisions = append(revisions, &list.Items[i])
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return revisions, nil
+}
+
+// CheckRevisionHistory records the current spec of clientResource as the latest revision when it is not the current one.
+// A spec which has already been recorded (e.g. after a rollback) gets a new revision number. The oldest revisions above
+// the history limit are deleted.
+func (r *EasyHttpReconciler) CheckRevisionHistory(ctx context.Context, clientResource *httpapiv2.EasyHttp) error {
+	log := log.FromContext(ctx)
+	newRev, err := initRevision(clientResource, 0)
+	if err != nil {
+		return err
+	}
+	if clientResource.Status.CurrentRevision == newRev.Name {
+		return nil
+	}
+
+	revisions, err := r.listRevisions(ctx, clientResource)
+	if err != nil {
+		return err
+	}
+	var next int64 = 1
+	if len(revisions) > 0 {
+		next = revisions[len(revisions)-1].Revision + 1
+	}
+	var current *appsv1.ControllerRevision
+	for i, rev := range revisions {
+		if rev.Name == newRev.Name {
+			current = rev
+			revisions = append(revisions[:i], revisions[i+1:]...)
+			break
+		}
+	}
+
+	switch {
+	case current == nil:
+		newRev.Revision = next
+		if err = ctrl.SetControllerReference(clientResource, newRev, r.Scheme); err != nil {
+			return fmt.Errorf("cannot set owner of revision %s. %v", newRev.Name, err)
+		}
+		if err = r.Create(ctx, newRev); err != nil {
+			return fmt.Errorf("cannot create revision %s. %v", newRev.Name, err)
+		}
+	case current.Revision != next-1:
+		current.Revision = next
+		if current.Annotations == nil {
+			current.Annotations = make(map[string]string)
+		}
+		current.Annotations[annotationRevisionApplied] = newRev.Annotations[annotationRevisionApplied]
+		if err = r.Update(ctx, current); err != nil {
+			return fmt.Errorf("cannot update revision %s. %v", current.Name, err)
+		}
+	}
+	log.Info(fmt.Sprintf("Current revision is: %v", newRev.Name))
+	clientResource.Status.CurrentRevision = newRev.Name
+
+	// the current revision is always kept
+	limit := httpapiv2.DefaultRevisionHistoryLimit
+	if clientResource.Spec.RevisionHistoryLimit != nil {
+		limit = *clientResource.Spec.RevisionHistoryLimit
+	}
+	for i := 0; i < len(revisions)-int(limit-1); i++ {
+		if err = r.Delete(ctx, revisions[i]); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("cannot delete revision %s. %v", revisions[i].Name, err)
+		}
+		log.Info(fmt.Sprintf("Revision %v has been deleted", revisions[i].Name))
+	}
+	return nil
+}
+
+// rollbackToRevision replaces the spec of clientResource with the spec recorded in the revision requested with the
+// rollback annotation (by name or number), then removes the annotation. The spec is reconciled in the next loop.
+func (r *EasyHttpReconciler) rollbackToRevision(ctx context.Context, clientResource *httpapiv2.EasyHttp, revision string) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	revisions, err := r.listRevisions(ctx, clientResource)
+	if err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	eventType, reason, message := corev1.EventTypeWarning, httpapiv2.ReasonActionIgnored,
+		fmt.Sprintf("Rollback has been ignored, there is no revision %q", revision)
+	for _, rev := range revisions {
+		if rev.Name != revision && strconv.FormatInt(rev.Revision, 10) != revision {
+			continue
+		}
+		spec := httpapiv2.EasyHttpSpec{}
+		if err = json.Unmarshal(rev.Data.Raw, &spec); err != nil {
+			message = fmt.Sprintf("Rollback has been ignored, revision %s cannot be decoded. %v", rev.Name, err)
+			break
+		}
+		spec.Scaling = clientResource.Spec.Scaling
+		spec.RevisionHistoryLimit = clientResource.Spec.RevisionHistoryLimit
+		clientResource.Spec = spec
+		eventType, reason, message = corev1.EventTypeNormal, httpapiv2.ReasonRevisionRestored,
+			fmt.Sprintf("Spec has been rolled back to revision %d (%s), image %s", rev.Revision, rev.Name, rev.Annotations[annotationRevisionImage])
+		break
+	}
+
+	delete(clientResource.Annotations, httpapiv2.AnnotationRollbackTo)
+	if err = r.Update(ctx, clientResource); err != nil {
+		return ctrl.Result{}, fmt.Errorf("cannot roll back to revision %q. %v", revision, err)
+	}
+	log.Info(message)
+	r.Recorder.Event(clientResource, eventType, reason, message)
+	return ctrl.Result{}, nil
+}
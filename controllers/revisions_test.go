@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	appsv1 "k8s.io/api/apps/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// ownedRevision returns the revision of clientResource with the given tag and number
+func ownedRevision(t *testing.T, reconciler *EasyHttpReconciler, clientResource *httpapiv2.EasyHttp, tag string, revision int64) appsv1.ControllerRevision {
+	tagged := clientResource.DeepCopy()
+	tagged.Spec.Container.Tag = tag
+	rev, err := initRevision(tagged, revision)
+	assert.NoError(t, err)
+	assert.NoError(t, ctrl.SetControllerReference(clientResource, rev, reconciler.Scheme))
+	return *rev
+}
+
+// listReturns returns a mock Run function which fills the revision list
+func listReturns(revisions ...appsv1.ControllerRevision) func(args mock.Arguments) {
+	return func(args mock.Arguments) {
+		args.Get(1).(*appsv1.ControllerRevisionList).Items = revisions
+	}
+}
+
+func TestInitRevision(t *testing.T) {
+	clientResource := newTestResource()
+	rev, err := initRevision(clientResource, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), rev.Revision)
+	assert.Equal(t, "testimage:1.0", rev.Annotations[annotationRevisionImage])
+	assert.NotEmpty(t, rev.Annotations[annotationRevisionApplied])
+	assert.Equal(t, map[string]string{labelRevisionOwner: "app1"}, rev.Labels)
+
+	// the scaling does not change the revision, the image does
+	var replicas int32 = 5
+	clientResource.Spec.Scaling.Replicas = &replicas
+	scaled, _ := initRevision(clientResource, 3)
+	assert.Equal(t, rev.Name, scaled.Name)
+	clientResource.Spec.Container.Tag = "3.0"
+	updated, _ := initRevision(clientResource, 3)
+	assert.NotEqual(t, rev.Name, updated.Name)
+}
+
+// TestCheckRevisionHistoryOK positive test for a new spec: it is recorded as the latest revision and the oldest revision is deleted
+func TestCheckRevisionHistoryOK(t *testing.T) {
+	reconciler, _ := setup(t)
+	clientResource := newTestResource()
+	clientResource.Spec.Container.Tag = "2.0"
+	var limit int32 = 2
+	clientResource.Spec.RevisionHistoryLimit = &limit
+	oldest := ownedRevision(t, reconciler, clientResource, "0.9", 1)
+	previous := ownedRevision(t, reconciler, clientResource, "1.0", 2)
+
+	var created *appsv1.ControllerRevision
+	clientMock.On("List", mock.Anything, mock.AnythingOfType("*v1.ControllerRevisionList"), mock.Anything, mock.Anything).Return(nil).Run(listReturns(previous, oldest)).Once()
+	clientMock.On("Create", mock.Anything, mock.AnythingOfType("*v1.ControllerRevision")).Return(nil).Run(func(args mock.Arguments) {
+		created = args.Get(1).(*appsv1.ControllerRevision)
+	}).Once()
+	clientMock.On("Delete", mock.Anything, mock.MatchedBy(func(rev *appsv1.ControllerRevision) bool { return rev.Name == oldest.Name })).Return(nil).Once()
+	defer clientMock.AssertExpectations(t)
+
+	err := reconciler.CheckRevisionHistory(context.Background(), clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), created.Revision)
+	assert.Equal(t, created.Name, clientResource.Status.CurrentRevision)
+	assert.Equal(t, "app1", created.OwnerReferences[0].Name)
+
+	// the current revision is not recorded again
+	err = reconciler.CheckRevisionHistory(context.Background(), clientResource)
+	assert.NoError(t, err)
+}
+
+func TestRollbackToRevision(t *testing.T) {
+	tests := map[string]struct {
+		revision string
+		tag      string
+		reason   string
+	}{
+		"by number":        {revision: "1", tag: "1.0", reason: httpapiv2.ReasonRevisionRestored},
+		"unknown revision": {revision: "7", tag: "2.0", reason: httpapiv2.ReasonActionIgnored},
+	}
+
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			reconciler, _ := setup(t)
+			clientResource := newTestResource()
+			clientResource.Spec.Container.Tag = "2.0"
+			clientResource.Annotations = map[string]string{httpapiv2.AnnotationRollbackTo: v.revision}
+			previous := ownedRevision(t, reconciler, clientResource, "1.0", 1)
+
+			clientMock.On("List", mock.Anything, mock.AnythingOfType("*v1.ControllerRevisionList"), mock.Anything, mock.Anything).Return(nil).Run(listReturns(previous)).Once()
+			clientMock.On("Update", mock.Anything, clientResource).Return(nil).Once()
+			defer clientMock.AssertExpectations(t)
+
+			_, err := reconciler.rollbackToRevision(context.Background(), clientResource, v.revision)
+
+			assert.NoError(t, err)
+			assert.NotContains(t, clientResource.Annotations, httpapiv2.AnnotationRollbackTo)
+			assert.Equal(t, v.tag, clientResource.Spec.Container.Tag)
+			// the scaling is not rolled back
+			assert.Equal(t, int32(2), *clientResource.Spec.Scaling.Replicas)
+			assertEvent(t, reconciler, v.reason)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// crashLoopReason is the reason of the waiting state of a container which is restarted repeatedly after failing
+const crashLoopReason = "CrashLoopBackOff"
+
+// deploymentRevisionAnnotation is the revision of a Deployment and of its ReplicaSets set by the deployment controller
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// rolledBack returns true if the rollout of the current spec of clientResource has failed and has been rolled back. The
+// spec is compared by its revision, so the scaling of the application does not change it.
+func rolledBack(clientResource *httpapiv2.EasyHttp) bool {
+	if clientResource.Status.LastGoodSpec == nil || clientResource.Status.RolledBackRevision == "" {
+		return false
+	}
+	name, _, err := revisionName(clientResource)
+	return err == nil && name == clientResource.Status.RolledBackRevision
+}
+
+// rollbackResource returns the EasyHttp the rolled back deployment is built from: the application with the last good spec.
+// The replicas are always the current ones, so scaling is not rolled back.
+func rollbackResource(clientResource *httpapiv2.EasyHttp) *httpapiv2.EasyHttp {
+	good := clientResource.DeepCopy()
+	good.Spec = *clientResource.Status.LastGoodSpec.DeepCopy()
+	good.Spec.Scaling = *clientResource.Spec.Scaling.DeepCopy()
+	return good
+}
+
+// rolloutFailure checks whether the rollout of newDep (the deployment of the current spec) has failed and the deployment
+// can be rolled back to the last good spec. The rollout fails when its progress deadline has been exceeded, its replicas
+// cannot be created or the pods of the rollout (the pods of the new ReplicaSet of the live deployment dep) are crash
+// looping. Returns the reason and the message of the failure.
+func (r *EasyHttpReconciler) rolloutFailure(ctx context.Context, clientResource *httpapiv2.EasyHttp, newDep, dep *appsv1.Deployment,
+	params deploymentParams) (bool, string, string, error) {
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionDeploymentReady)
+	if clientResource.Status.LastGoodSpec == nil || cond == nil || cond.Status == metav1.ConditionTrue {
+		return false, "", "", nil
+	}
+	// there is nothing to roll back to when the last good spec has the same deployment
+	if equality.Semantic.DeepEqual(initDeployment(rollbackResource(clientResource), params).Spec, newDep.Spec) {
+		return false, "", "", nil
+	}
+	switch cond.Reason {
+	case httpapiv2.ReasonProgressDeadline, httpapiv2.ReasonReplicaFailure:
+		return true, cond.Reason, cond.Message, nil
+	case httpapiv2.ReasonRolloutInProgress:
+		rs, err := r.newReplicaSet(ctx, dep)
+		if err != nil || rs == nil {
+			return false, "", "", err
+		}
+		pods := &corev1.PodList{}
+		if err := r.List(ctx, pods, client.InNamespace(clientResource.Namespace), client.MatchingLabels(rs.Spec.Selector.MatchLabels)); err != nil {
+			return false, "", "", fmt.Errorf("cannot list pods of deployment %s, retying later. %v", dep.Name, err)
+		}
+		if name, message := crashLoopingPod(pods.Items); name != "" {
+			return true, httpapiv2.ReasonCrashLoop, fmt.Sprintf("Pod %s is crash looping: %s", name, message), nil
+		}
+	}
+	return false, "", "", nil
+}
+
+// newReplicaSet returns the ReplicaSet of the current revision of the live deployment dep, nil when the deployment
+// controller has not observed the spec of dep yet. The pods of the other ReplicaSets run the previous revisions.
+func (r *EasyHttpReconciler) newReplicaSet(ctx context.Context, dep *appsv1.Deployment) (*appsv1.ReplicaSet, error) {
+	revision := dep.Annotations[deploymentRevisionAnnotation]
+	if revision == "" || dep.Generation > dep.Status.ObservedGeneration {
+		return nil, nil
+	}
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := r.List(ctx, replicaSets, client.InNamespace(dep.Namespace), client.MatchingLabels(dep.Spec.Selector.MatchLabels)); err != nil {
+		return nil, fmt.Errorf("cannot list replica sets of deployment %s, retying later. %v", dep.Name, err)
+	}
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if metav1.IsControlledBy(rs, dep) && rs.Annotations[deploymentRevisionAnnotation] == revision {
+			return rs, nil
+		}
+	}
+	return nil, nil
+}
+
+// crashLoopingPod returns the name of the first pod with a crash looping container and the message of its last failure
+func crashLoopingPod(pods []corev1.Pod) (string, string) {
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Waiting == nil || status.State.Waiting.Reason != crashLoopReason {
+				continue
+			}
+			message := status.State.Waiting.Message
+			if terminated := status.LastTerminationState.Terminated; terminated != nil {
+				message = fmt.Sprintf("container %s exited with %d (%s)", status.Name, terminated.ExitCode, terminated.Reason)
+			}
+			return pod.Name, message
+		}
+	}
+	return "", ""
+}
+
+// rollback records that the rollout of the current spec of clientResource has failed, so its deployment is built from the
+// last good spec until the spec changes
+func (r *EasyHttpReconciler) rollback(ctx context.Context, clientResource *httpapiv2.EasyHttp, reason, message string) error {
+	name, _, err := revisionName(clientResource)
+	if err != nil {
+		return err
+	}
+	clientResource.Status.RolledBackRevision = name
+	message = fmt.Sprintf("Rollout of revision %s has failed, rolled back to image tag %s. %s",
+		name, clientResource.Status.LastGoodSpec.Container.Tag, message)
+	log.FromContext(ctx).Info(message)
+	r.Recorder.Event(clientResource, corev1.EventTypeWarning, httpapiv2.ReasonRolledBack, message)
+	setCondition(clientResource, httpapiv2.ConditionRolledBack, metav1.ConditionTrue, reason, message)
+	return nil
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// withLastGoodSpec makes the previous tag 1.0 of clientResource its last good spec, the application running the tag 2.0
+func withLastGoodSpec(clientResource *httpapiv2.EasyHttp) *httpapiv2.EasyHttp {
+	clientResource.Status.LastGoodSpec = clientResource.Spec.DeepCopy()
+	clientResource.Spec.Container.Tag = "2.0"
+	return clientResource
+}
+
+func TestCrashLoopingPod(t *testing.T) {
+	running := corev1.Pod{}
+	running.Name = "pod1"
+	running.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app1", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}}
+	crashing := corev1.Pod{}
+	crashing.Name = "pod2"
+	crashing.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:                 "app1",
+		State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: crashLoopReason}},
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+	}}
+
+	name, _ := crashLoopingPod([]corev1.Pod{running})
+	assert.Equal(t, "", name)
+	name, message := crashLoopingPod([]corev1.Pod{running, crashing})
+	assert.Equal(t, "pod2", name)
+	assert.Equal(t, "container app1 exited with 1 (Error)", message)
+}
+
+// TestRolloutFailureCrashLoop positive test for crash looping pods: only the pods of the new ReplicaSet fail the rollout
+func TestRolloutFailureCrashLoop(t *testing.T) {
+	reconciler, _ := setup(t)
+	ctx := context.Background()
+
+	clientResource := withLastGoodSpec(newTestResource())
+	setCondition(clientResource, httpapiv2.ConditionDeploymentReady, metav1.ConditionFalse, httpapiv2.ReasonRolloutInProgress, "")
+	newDep := initDeployment(clientResource, deploymentParams{})
+	dep := newDep.DeepCopy()
+	dep.UID = "dep-uid"
+	dep.Annotations = map[string]string{deploymentRevisionAnnotation: "2"}
+
+	replicaSet := func(revision, hash string) appsv1.ReplicaSet {
+		rs := appsv1.ReplicaSet{}
+		rs.Name = "app1-" + hash
+		rs.Namespace = "namespace1"
+		rs.Annotations = map[string]string{deploymentRevisionAnnotation: revision}
+		assert.NoError(t, ctrl.SetControllerReference(dep, &rs, reconciler.Scheme))
+		rs.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app1", appsv1.DefaultDeploymentUniqueLabelKey: hash}}
+		return rs
+	}
+	oldRS, newRS := replicaSet("1", "old"), replicaSet("2", "new")
+	pod := func(name string, state corev1.ContainerState) corev1.Pod {
+		p := corev1.Pod{}
+		p.Name = name
+		p.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app1", State: state}}
+		return p
+	}
+	crashing := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: crashLoopReason, Message: "back-off"}}
+
+	tests := map[string]struct {
+		newPods []corev1.Pod
+		failed  bool
+	}{
+		// the crash looping pod of the old ReplicaSet is not listed
+		"old revision crash looping": {newPods: []corev1.Pod{pod("new", corev1.ContainerState{Running: &corev1.ContainerStateRunning{}})}},
+		"new revision crash looping": {newPods: []corev1.Pod{pod("new", crashing)}, failed: true},
+	}
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			clientMock.On("List", mock.Anything, mock.AnythingOfType("*v1.ReplicaSetList"), mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				args.Get(1).(*appsv1.ReplicaSetList).Items = []appsv1.ReplicaSet{oldRS, newRS}
+			}).Once()
+			clientMock.On("List", mock.Anything, mock.AnythingOfType("*v1.PodList"), client.InNamespace("namespace1"), client.MatchingLabels(newRS.Spec.Selector.MatchLabels)).Return(nil).Run(func(args mock.Arguments) {
+				args.Get(1).(*corev1.PodList).Items = v.newPods
+			}).Once()
+			defer clientMock.AssertExpectations(t)
+
+			failed, reason, _, err := reconciler.rolloutFailure(ctx, clientResource, newDep, dep, deploymentParams{})
+
+			assert.NoError(t, err)
+			assert.Equal(t, v.failed, failed)
+			if v.failed {
+				assert.Equal(t, httpapiv2.ReasonCrashLoop, reason)
+			}
+		})
+	}
+
+	// the new ReplicaSet is not known until the deployment controller has observed the spec
+	dep.Generation = 2
+	failed, _, _, err := reconciler.rolloutFailure(ctx, clientResource, newDep, dep, deploymentParams{})
+	assert.NoError(t, err)
+	assert.False(t, failed)
+}
+
+// TestCheckDeploymentRollbackOK positive test for a rollout exceeding its progress deadline: the deployment is rolled back
+func TestCheckDeploymentRollbackOK(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := withLastGoodSpec(newTestResource())
+	failedDep := initDeployment(clientResource, deploymentParams{})
+	failedDep.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: deploymentTimedOutReason, Message: "timed out"}}
+
+	var applied *appsv1.Deployment
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Run(getReturns(failedDep)).Twice()
+	clientMock.On("Patch", mock.Anything, mock.AnythingOfType("*v1.Deployment"), client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership).Return(nil).Run(func(args mock.Arguments) {
+		applied = args.Get(1).(*appsv1.Deployment)
+		applied.SetResourceVersion("2")
+	}).Once()
+	clientMock.On("Status", mock.Anything, mock.Anything).Return(&subResourceWriterMock).Once()
+	subResourceWriterMock.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+	defer subResourceWriterMock.AssertExpectations(t)
+	defer clientMock.AssertExpectations(t)
+
+	_, err := reconciler.CheckDeployment(ctx, *req, false, clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "testimage:1.0", applied.Spec.Template.Spec.Containers[0].Image)
+	rev, err := initRevision(clientResource, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, rev.Name, clientResource.Status.RolledBackRevision)
+	assert.Equal(t, "1.0", clientResource.Status.LastGoodSpec.Container.Tag)
+	cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionRolledBack)
+	assert.NotNil(t, cond)
+	assert.Equal(t, httpapiv2.ReasonProgressDeadline, cond.Reason)
+	assertEvent(t, reconciler, httpapiv2.ReasonRolledBack)
+	assertEvent(t, reconciler, httpapiv2.ReasonUpdated)
+
+	updateReadyCondition(clientResource)
+	cond = meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionReady)
+	assert.Equal(t, httpapiv2.ReasonRolledBack, cond.Reason)
+
+	// scaling the application does not retry the rollout, a new spec does
+	var replicas int32 = 5
+	clientResource.Spec.Scaling.Replicas = &replicas
+	assert.True(t, rolledBack(clientResource))
+	clientResource.Spec.Container.Tag = "2.1"
+	assert.False(t, rolledBack(clientResource))
+}
+
+// TestCheckDeploymentRecordsLastGoodSpec positive test for a completed rollout: its spec becomes the last good one
+func TestCheckDeploymentRecordsLastGoodSpec(t *testing.T) {
+	reconciler, req := setup(t)
+	ctx := context.Background()
+
+	clientResource := withLastGoodSpec(newTestResource())
+	dep := initDeployment(clientResource, deploymentParams{})
+	dep.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+
+	clientMock.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.Deployment")).Return(nil).Run(getReturns(dep)).Once()
+	defer clientMock.AssertExpectations(t)
+
+	_, err := reconciler.CheckDeployment(ctx, *req, false, clientResource)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2.0", clientResource.Status.LastGoodSpec.Container.Tag)
+	assert.False(t, isConditionTrue(clientResource, httpapiv2.ConditionRolledBack))
+}
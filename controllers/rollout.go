@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// rolloutRequeueDelay is the delay of the next reconcile while the rollout of the deployment is in progress
+const rolloutRequeueDelay = 10 * time.Second
+
+// deploymentTimedOutReason is the reason of the Progressing condition set by the deployment controller
+// when the progress deadline of the rollout has been exceeded
+const deploymentTimedOutReason = "ProgressDeadlineExceeded"
+
+// updateRolloutStatus copies the replica counts and the pod selector of dep into the status of clientResource and sets the
+// DeploymentReady condition according to the rollout progress. Requeues while the rollout has not settled.
+func updateRolloutStatus(clientResource *httpapiv2.EasyHttp, dep *appsv1.Deployment) ctrl.Result {
+	var desired int32 = 1
+	if dep.Spec.Replicas != nil {
+		desired = *dep.Spec.Replicas
+	}
+	clientResource.Status.DesiredReplicas = desired
+	clientResource.Status.Replicas = dep.Status.Replicas
+	clientResource.Status.UpdatedReplicas = dep.Status.UpdatedReplicas
+	clientResource.Status.ReadyReplicas = dep.Status.ReadyReplicas
+	clientResource.Status.AvailableReplicas = dep.Status.AvailableReplicas
+	if dep.Spec.Selector != nil {
+		clientResource.Status.Selector = metav1.FormatLabelSelector(dep.Spec.Selector)
+	}
+
+	ready, reason, message := rolloutProgress(dep, desired)
+	if ready {
+		setCondition(clientResource, httpapiv2.ConditionDeploymentReady, metav1.ConditionTrue, reason, message)
+		return ctrl.Result{}
+	}
+	setCondition(clientResource, httpapiv2.ConditionDeploymentReady, metav1.ConditionFalse, reason, message)
+	if reason != httpapiv2.ReasonRolloutInProgress {
+		// the rollout failed, the next change of the deployment triggers a new reconcile
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: rolloutRequeueDelay}
+}
+
+// rolloutProgress evaluates the status of dep the same way as 'kubectl rollout status' does
+func rolloutProgress(dep *appsv1.Deployment, desired int32) (bool, string, string) {
+	if dep.Generation > dep.Status.ObservedGeneration {
+		return false, httpapiv2.ReasonRolloutInProgress, "Waiting for the deployment spec update to be observed"
+	}
+	for _, c := range dep.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == deploymentTimedOutReason {
+			return false, httpapiv2.ReasonProgressDeadline, c.Message
+		}
+		if c.Type == appsv1.DeploymentReplicaFailure && c.Status == corev1.ConditionTrue {
+			return false, httpapiv2.ReasonReplicaFailure, c.Message
+		}
+	}
+	if dep.Status.UpdatedReplicas < desired {
+		return false, httpapiv2.ReasonRolloutInProgress,
+			fmt.Sprintf("%d out of %d new replicas have been updated", dep.Status.UpdatedReplicas, desired)
+	}
+	if dep.Status.Replicas > dep.Status.UpdatedReplicas {
+		return false, httpapiv2.ReasonRolloutInProgress,
+			fmt.Sprintf("%d old replicas are pending termination", dep.Status.Replicas-dep.Status.UpdatedReplicas)
+	}
+	if dep.Status.AvailableReplicas < dep.Status.UpdatedReplicas {
+		return false, httpapiv2.ReasonRolloutInProgress,
+			fmt.Sprintf("%d of %d updated replicas are available", dep.Status.AvailableReplicas, dep.Status.UpdatedReplicas)
+	}
+	return true, httpapiv2.ReasonRolloutComplete, fmt.Sprintf("%d of %d replicas are available", dep.Status.AvailableReplicas, desired)
+}
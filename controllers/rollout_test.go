@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestUpdateRolloutStatus(t *testing.T) {
+
+	var replicas3 int32 = 3
+
+	tests := map[string]struct {
+		status appsv1.DeploymentStatus
+		result ctrl.Result
+		ready  metav1.ConditionStatus
+		reason string
+	}{
+		"rollout complete": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 3},
+			result: ctrl.Result{},
+			ready:  metav1.ConditionTrue,
+			reason: httpapiv2.ReasonRolloutComplete,
+		},
+		"generation not observed": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 3},
+			result: ctrl.Result{RequeueAfter: rolloutRequeueDelay},
+			ready:  metav1.ConditionFalse,
+			reason: httpapiv2.ReasonRolloutInProgress,
+		},
+		"old replicas running": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, ReadyReplicas: 4, AvailableReplicas: 4},
+			result: ctrl.Result{RequeueAfter: rolloutRequeueDelay},
+			ready:  metav1.ConditionFalse,
+			reason: httpapiv2.ReasonRolloutInProgress,
+		},
+		"updated replicas not available": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 1, AvailableReplicas: 1},
+			result: ctrl.Result{RequeueAfter: rolloutRequeueDelay},
+			ready:  metav1.ConditionFalse,
+			reason: httpapiv2.ReasonRolloutInProgress,
+		},
+		"progress deadline exceeded": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 0,
+				Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: deploymentTimedOutReason}}},
+			result: ctrl.Result{},
+			ready:  metav1.ConditionFalse,
+			reason: httpapiv2.ReasonProgressDeadline,
+		},
+		"replica failure": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2,
+				Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentReplicaFailure, Status: corev1.ConditionTrue, Reason: "FailedCreate"}}},
+			result: ctrl.Result{},
+			ready:  metav1.ConditionFalse,
+			reason: httpapiv2.ReasonReplicaFailure,
+		},
+	}
+
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			clientResource := httpapiv2.EasyHttp{}
+			dep := appsv1.Deployment{}
+			dep.Generation = 2
+			dep.Spec.Replicas = &replicas3
+			dep.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app1"}}
+			dep.Status = v.status
+
+			res := updateRolloutStatus(&clientResource, &dep)
+
+			assert.Equal(t, v.result, res)
+			cond := meta.FindStatusCondition(clientResource.Status.Conditions, httpapiv2.ConditionDeploymentReady)
+			assert.NotNil(t, cond)
+			assert.Equal(t, v.ready, cond.Status)
+			assert.Equal(t, v.reason, cond.Reason)
+			assert.Equal(t, replicas3, clientResource.Status.DesiredReplicas)
+			assert.Equal(t, v.status.AvailableReplicas, clientResource.Status.AvailableReplicas)
+			assert.Equal(t, "app=app1", clientResource.Status.Selector)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"fmt"
+	"os"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// SizePresets are the named compute resources of the application container, configured at operator level
+type SizePresets map[string]corev1.ResourceRequirements
+
+// DefaultSizePresets returns the presets used when the operator is not configured with a presets file
+func DefaultSizePresets() SizePresets {
+	return SizePresets{
+		"small":  sizePreset("100m", "128Mi", "250m", "128Mi"),
+		"medium": sizePreset("250m", "256Mi", "500m", "512Mi"),
+		"large":  sizePreset("500m", "512Mi", "1", "1Gi"),
+	}
+}
+
+func sizePreset(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpuRequest),
+			corev1.ResourceMemory: resource.MustParse(memoryRequest),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpuLimit),
+			corev1.ResourceMemory: resource.MustParse(memoryLimit),
+		},
+	}
+}
+
+// LoadSizePresets reads the presets from a YAML file mapping the preset names to requests and limits, e.g.
+//
+//	small:
+//	  requests: {cpu: 100m, memory: 128Mi}
+//	  limits: {memory: 128Mi}
+func LoadSizePresets(path string) (SizePresets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read size presets. %v", err)
+	}
+	presets := SizePresets{}
+	if err := yaml.UnmarshalStrict(data, &presets); err != nil {
+		return nil, fmt.Errorf("cannot parse size presets %s. %v", path, err)
+	}
+	return presets, nil
+}
+
+// containerResources returns the resources of the application container. The requests and limits of the preset
+// are overridden by the explicitly set ones resource by resource.
+func containerResources(clientResource *httpapiv2.EasyHttp, presets SizePresets) (corev1.ResourceRequirements, error) {
+	spec := clientResource.Spec.Resources
+	ret := corev1.ResourceRequirements{}
+	if spec.Preset != "" {
+		preset, ok := presets[spec.Preset]
+		if !ok {
+			return ret, fmt.Errorf("size preset %s is not configured in the operator", spec.Preset)
+		}
+		ret = *preset.DeepCopy()
+	}
+	ret.Requests = mergeResourceList(ret.Requests, spec.Requests)
+	ret.Limits = mergeResourceList(ret.Limits, spec.Limits)
+	return ret, nil
+}
+
+// mergeResourceList returns base overridden by overrides, nil when both are empty
+func mergeResourceList(base, overrides corev1.ResourceList) corev1.ResourceList {
+	if len(overrides) == 0 {
+		return base
+	}
+	if base == nil {
+		base = corev1.ResourceList{}
+	}
+	for name, quantity := range overrides {
+		base[name] = quantity.DeepCopy()
+	}
+	return base
+}
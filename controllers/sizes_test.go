@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestContainerResources(t *testing.T) {
+	clientResource := httpapiv2.EasyHttp{}
+
+	tests := map[string]struct {
+		resources httpapiv2.ResourcesSpec
+		expected  corev1.ResourceRequirements
+		err       bool
+	}{
+		"no resources": {},
+		"explicit": {
+			resources: httpapiv2.ResourcesSpec{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+				Limits:   corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+			},
+			expected: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+				Limits:   corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+			},
+		},
+		"preset": {
+			resources: httpapiv2.ResourcesSpec{Preset: "small"},
+			expected:  DefaultSizePresets()["small"],
+		},
+		"preset with overrides": {
+			resources: httpapiv2.ResourcesSpec{
+				Preset: "large",
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+			},
+			expected: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("2Gi")},
+			},
+		},
+		"unknown preset": {
+			resources: httpapiv2.ResourcesSpec{Preset: "huge"},
+			err:       true,
+		},
+	}
+
+	for k, v := range tests {
+		t.Run(k, func(t *testing.T) {
+			clientResource.Spec.Resources = v.resources
+
+			ret, err := containerResources(&clientResource, DefaultSizePresets())
+
+			if v.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, v.expected, ret)
+		})
+	}
+
+	// the presets are not modified by the overrides
+	assert.Equal(t, resource.MustParse("1Gi"), DefaultSizePresets()["large"].Limits[corev1.ResourceMemory])
+}
+
+func TestLoadSizePresets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "presets.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+tiny:
+  requests: {cpu: 10m, memory: 32Mi}
+  limits: {memory: 32Mi, ephemeral-storage: 100Mi}
+`), 0600))
+
+	presets, err := LoadSizePresets(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, SizePresets{"tiny": {
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m"), corev1.ResourceMemory: resource.MustParse("32Mi")},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("32Mi"), corev1.ResourceEphemeralStorage: resource.MustParse("100Mi")},
+	}}, presets)
+
+	assert.NoError(t, os.WriteFile(path, []byte("tiny:\n  request: {}\n"), 0600))
+	_, err = LoadSizePresets(path)
+	assert.Error(t, err)
+
+	_, err = LoadSizePresets(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
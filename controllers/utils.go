@@ -1,13 +1,38 @@
 package controllers
 
 import (
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
 	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
-func convertEnv(m map[string]string) []corev1.EnvVar {
+// convertEnv converts the env of the application into container env vars keeping their order
+func convertEnv(env []httpapiv2.EnvVar) []corev1.EnvVar {
 	var ret []corev1.EnvVar
-	for k, v := range m {
-		ret = append(ret, corev1.EnvVar{Name: k, Value: v})
+	for _, e := range env {
+		envVar := corev1.EnvVar{Name: e.Name, Value: e.Value}
+		if e.ValueFrom != nil {
+			envVar.ValueFrom = &corev1.EnvVarSource{
+				SecretKeyRef:    e.ValueFrom.SecretKeyRef.DeepCopy(),
+				ConfigMapKeyRef: e.ValueFrom.ConfigMapKeyRef.DeepCopy(),
+				FieldRef:        e.ValueFrom.FieldRef.DeepCopy(),
+			}
+		}
+		ret = append(ret, envVar)
+	}
+	return ret
+}
+
+// earliestResult merges two reconcile results, the earliest requeue wins
+func earliestResult(a, b ctrl.Result) ctrl.Result {
+	ret := ctrl.Result{Requeue: a.Requeue || b.Requeue}
+	switch {
+	case a.RequeueAfter == 0:
+		ret.RequeueAfter = b.RequeueAfter
+	case b.RequeueAfter == 0 || a.RequeueAfter < b.RequeueAfter:
+		ret.RequeueAfter = a.RequeueAfter
+	default:
+		ret.RequeueAfter = b.RequeueAfter
 	}
 	return ret
 }
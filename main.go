@@ -32,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	httpapiv1 "github.com/akosbalogh005/easyhttp-operator/api/v1"
+	httpapiv2 "github.com/akosbalogh005/easyhttp-operator/api/v2"
 	"github.com/akosbalogh005/easyhttp-operator/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -45,6 +46,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(httpapiv1.AddToScheme(scheme))
+	utilruntime.Must(httpapiv2.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,11 +54,21 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var defaulter httpapiv2.EasyHttpDefaulter
+	var sizePresetsFile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&defaulter.IngressClassName, "default-ingress-class", "",
+		"The ingress class set in EasyHttp resources without ingress class. The default class of the cluster is used when empty.")
+	flag.StringVar(&defaulter.CertManIssuer, "default-cert-issuer", "",
+		"The cert manager issuer set in EasyHttp resources without issuer. TLS is not requested by default when empty.")
+	flag.StringVar(&defaulter.IngressProvider, "default-ingress-provider", "",
+		"The ingress provider (nginx, traefik, haproxy or none) set in EasyHttp resources without provider. nginx is used when empty.")
+	flag.StringVar(&sizePresetsFile, "size-presets-file", "",
+		"The YAML file of the resource size presets selectable in EasyHttp resources. The built-in small, medium and large presets are used when empty.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -72,6 +84,8 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "571f8272.github.com",
+		// the referenced ConfigMaps and Secrets are read directly, only their metadata is cached
+		ClientDisableCacheFor: controllers.ConfigMapsAndSecretsUncached,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -89,13 +103,30 @@ func main() {
 		os.Exit(1)
 	}
 
+	sizePresets := controllers.DefaultSizePresets()
+	if sizePresetsFile != "" {
+		if sizePresets, err = controllers.LoadSizePresets(sizePresetsFile); err != nil {
+			setupLog.Error(err, "unable to load size presets")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.EasyHttpReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Recorder:    mgr.GetEventRecorderFor("easyhttp-controller"),
+		SizePresets: sizePresets,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "EasyHttp")
 		os.Exit(1)
 	}
+	// webhooks can be disabled when running the operator locally (make run) without serving certificates
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&httpapiv2.EasyHttp{}).SetupWebhookWithManager(mgr, &defaulter); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "EasyHttp")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {